@@ -0,0 +1,297 @@
+package zont
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+type AnomalyKind string
+
+const (
+	// AnomalySpike is rate of change far from usual for sensor
+	AnomalySpike AnomalyKind = "spike"
+	// AnomalyHourly is value far from values of same hour in previous days
+	AnomalyHourly AnomalyKind = "hourly_deviation"
+	// AnomalyNoResponse is room which does not warm up after setpoint increase
+	AnomalyNoResponse AnomalyKind = "no_response"
+)
+
+// Anomaly is event found by anomaly detection
+type Anomaly struct {
+	Kind     AnomalyKind
+	DeviceID int
+	Sensor   string
+	Time     time.Time
+	Value    float64
+	Expected float64
+	// Score is distance from expected in standard deviations, for
+	// AnomalyNoResponse it is rise of temperature
+	Score   float64
+	Message string
+}
+
+// AnomalyOptions set thresholds of anomaly detection
+type AnomalyOptions struct {
+	// Threshold in standard deviations, 4 by default
+	Threshold float64
+	// SpikeWindow is count of previous rates used for statistics, 30 by default
+	SpikeWindow int
+	// MinRate is smallest rate of change in °C per hour reported as spike, 3 by default
+	MinRate float64
+	// Days is count of previous days compared by hour, 7 by default
+	Days int
+	// MinDeviation is smallest difference in °C from hourly mean reported, 2 by default
+	MinDeviation float64
+	// MinSetpointStep is smallest setpoint increase checked for response, 1 °C by default
+	MinSetpointStep float64
+	// MinRise is temperature rise expected after setpoint increase, 0.5 °C by default
+	MinRise float64
+	// ResponseTime to reach MinRise, 2 hours by default
+	ResponseTime time.Duration
+	// ZoneSensors map zone setpoint series key to room temperature series key,
+	// for example "thermostat_work/zones/1/target_temp" to "temperature/4096"
+	ZoneSensors map[string]string
+	// Location of reported times, DetectAnomalies use device local time
+	// (Device.Location) by default, other detections UTC
+	Location *time.Location
+}
+
+func (o *AnomalyOptions) defaults() {
+	if o.Threshold <= 0 {
+		o.Threshold = 4
+	}
+	if o.SpikeWindow <= 0 {
+		o.SpikeWindow = 30
+	}
+	if o.MinRate <= 0 {
+		o.MinRate = 3
+	}
+	if o.Days <= 0 {
+		o.Days = 7
+	}
+	if o.MinDeviation <= 0 {
+		o.MinDeviation = 2
+	}
+	if o.MinSetpointStep <= 0 {
+		o.MinSetpointStep = 1
+	}
+	if o.MinRise <= 0 {
+		o.MinRise = 0.5
+	}
+	if o.ResponseTime <= 0 {
+		o.ResponseTime = 2 * time.Hour
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+}
+
+// DetectAnomalies run all detections on temperature series of history of d and on
+// zones from ZoneSensors
+func DetectAnomalies(d *Device, h *History, opts AnomalyOptions) []Anomaly {
+	if opts.Location == nil {
+		opts.Location = deviceLocation(d)
+	}
+	opts.defaults()
+
+	var anomalies []Anomaly
+	for _, key := range h.Keys() {
+		if DataType(key) != "temperature" {
+			continue
+		}
+		name := h.Names[key]
+		if name == "" {
+			name = key
+		}
+		anomalies = append(anomalies, DetectSpikes(name, h.Series[key], opts)...)
+		anomalies = append(anomalies, DetectHourlyDeviation(name, h.Series[key], opts)...)
+	}
+	for targetKey, roomKey := range opts.ZoneSensors {
+		name := h.Names[roomKey]
+		if name == "" {
+			name = roomKey
+		}
+		anomalies = append(anomalies, DetectNoResponse(name, h.Series[roomKey], h.Series[targetKey], opts)...)
+	}
+
+	for i := range anomalies {
+		anomalies[i].DeviceID = h.DeviceID
+	}
+	return anomalies
+}
+
+// DetectSpikes find rates of change far from rolling statistics of previous rates
+func DetectSpikes(sensor string, s Series, opts AnomalyOptions) []Anomaly {
+	opts.defaults()
+
+	var anomalies []Anomaly
+	rates := make([]float64, 0, opts.SpikeWindow)
+	for i := 1; i < len(s); i++ {
+		dt := float64(s[i].Time-s[i-1].Time) / 3600
+		if dt <= 0 {
+			continue
+		}
+		rate := (s[i].Value - s[i-1].Value) / dt
+
+		if len(rates) >= opts.SpikeWindow/2 && math.Abs(rate) >= opts.MinRate {
+			mean, std := meanStd(rates)
+			score := math.Abs(rate-mean) / math.Max(std, 0.1)
+			if score >= opts.Threshold {
+				anomalies = append(anomalies, Anomaly{
+					Kind:     AnomalySpike,
+					Sensor:   sensor,
+					Time:     time.Unix(s[i].Time, 0).In(opts.Location),
+					Value:    s[i].Value,
+					Expected: s[i-1].Value + mean*dt,
+					Score:    score,
+					Message:  fmt.Sprintf("%s changed %.1f °C/h, usual %.1f±%.1f", sensor, rate, mean, std),
+				})
+				// spike is not added to statistics
+				continue
+			}
+		}
+
+		if len(rates) == opts.SpikeWindow {
+			rates = rates[1:]
+		}
+		rates = append(rates, rate)
+	}
+	return anomalies
+}
+
+// DetectHourlyDeviation compare hourly means with same hour of previous days
+func DetectHourlyDeviation(sensor string, s Series, opts AnomalyOptions) []Anomaly {
+	opts.defaults()
+
+	hourly := s.Resample(hourStart(s), hourEnd(s), time.Hour, AggMean)
+
+	var anomalies []Anomaly
+	for i, b := range hourly {
+		if b.Gap {
+			continue
+		}
+		var previous []float64
+		for d := 1; d <= opts.Days; d++ {
+			j := i - 24*d
+			if j < 0 {
+				break
+			}
+			if !hourly[j].Gap {
+				previous = append(previous, hourly[j].Value)
+			}
+		}
+		if len(previous) < 3 {
+			continue
+		}
+
+		mean, std := meanStd(previous)
+		deviation := math.Abs(b.Value - mean)
+		score := deviation / math.Max(std, 0.1)
+		if deviation >= opts.MinDeviation && score >= opts.Threshold {
+			start := time.Unix(b.Start, 0).In(opts.Location)
+			anomalies = append(anomalies, Anomaly{
+				Kind:     AnomalyHourly,
+				Sensor:   sensor,
+				Time:     start,
+				Value:    b.Value,
+				Expected: mean,
+				Score:    score,
+				Message:  fmt.Sprintf("%s %.1f °C at %s, usual %.1f±%.1f", sensor, b.Value, start.Format("15:04"), mean, std),
+			})
+		}
+	}
+	return anomalies
+}
+
+// DetectNoResponse find setpoint increases after which room temperature did not rise
+func DetectNoResponse(sensor string, room, target Series, opts AnomalyOptions) []Anomaly {
+	opts.defaults()
+	if len(room) == 0 {
+		return nil
+	}
+	responseTime := int64(opts.ResponseTime / time.Second)
+
+	var anomalies []Anomaly
+	for i := 1; i < len(target); i++ {
+		step := target[i].Value - target[i-1].Value
+		if step < opts.MinSetpointStep {
+			continue
+		}
+		at := target[i].Time
+		deadline := at + responseTime
+		if room[len(room)-1].Time < deadline {
+			// not enough data yet
+			continue
+		}
+		// setpoint changed back before response time
+		if i+1 < len(target) && target[i+1].Time < deadline && target[i+1].Value < target[i].Value {
+			continue
+		}
+
+		start, ok := valueAt(room, at)
+		if !ok {
+			continue
+		}
+		rise := math.Inf(-1)
+		for _, sample := range room {
+			if sample.Time > at && sample.Time <= deadline {
+				rise = math.Max(rise, sample.Value-start)
+			}
+		}
+		if rise < opts.MinRise {
+			if math.IsInf(rise, -1) {
+				rise = 0
+			}
+			anomalies = append(anomalies, Anomaly{
+				Kind:     AnomalyNoResponse,
+				Sensor:   sensor,
+				Time:     time.Unix(at, 0).In(opts.Location),
+				Value:    start + rise,
+				Expected: start + opts.MinRise,
+				Score:    rise,
+				Message: fmt.Sprintf("%s rose %.1f °C in %s after setpoint %.1f -> %.1f",
+					sensor, rise, opts.ResponseTime, target[i-1].Value, target[i].Value),
+			})
+		}
+	}
+	return anomalies
+}
+
+// valueAt return value of last sample at or before t
+func valueAt(s Series, t int64) (float64, bool) {
+	value, ok := 0.0, false
+	for _, sample := range s {
+		if sample.Time > t {
+			break
+		}
+		value, ok = sample.Value, true
+	}
+	return value, ok
+}
+
+func meanStd(values []float64) (mean, std float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		std += (v - mean) * (v - mean)
+	}
+	std = math.Sqrt(std / float64(len(values)))
+	return mean, std
+}
+
+func hourStart(s Series) time.Time {
+	if len(s) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s[0].Time, 0).Truncate(time.Hour)
+}
+
+func hourEnd(s Series) time.Time {
+	if len(s) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s[len(s)-1].Time, 0).Truncate(time.Hour).Add(time.Hour)
+}
@@ -0,0 +1,176 @@
+package zont
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDetectAnomaliesDeviceLocalTime(t *testing.T) {
+	d := &Device{}
+	d.Timezone = 5
+	start := time.Date(2023, 11, 14, 20, 0, 0, 0, time.UTC).Unix()
+
+	var room Series
+	for i := int64(0); i < 40; i++ {
+		room = append(room, Sample{Time: start + i*600, Value: 20 + float64(i%2)*0.1})
+	}
+	room = append(room, Sample{Time: start + 40*600, Value: 30})
+	target := Series{{Time: start, Value: 18}, {Time: start + 600, Value: 22}}
+
+	h := NewHistory(7)
+	h.Series["temperature/t1"] = room
+	h.Series["thermostat_work/zones/1/target_temp"] = target
+
+	anomalies := DetectAnomalies(d, h, AnomalyOptions{
+		ZoneSensors: map[string]string{"thermostat_work/zones/1/target_temp": "temperature/t1"},
+	})
+	kinds := map[AnomalyKind]bool{}
+	for _, a := range anomalies {
+		kinds[a.Kind] = true
+		if _, offset := a.Time.Zone(); offset != 5*3600 {
+			t.Errorf("%s time %v is not in device zone", a.Kind, a.Time)
+		}
+	}
+	if !kinds[AnomalySpike] || !kinds[AnomalyNoResponse] {
+		t.Errorf("got %v, want spike and no response", anomalies)
+	}
+}
+
+// steadySeries return samples every 10 minutes from start changing by step
+func steadySeries(start int64, count int, value, step float64) Series {
+	var s Series
+	for i := 0; i < count; i++ {
+		s = append(s, Sample{Time: start + int64(i)*600, Value: value + float64(i)*step})
+	}
+	return s
+}
+
+func TestDetectSpikes(t *testing.T) {
+	start := int64(1700000000)
+	// 0.6 °C/h with small noise
+	steady := steadySeries(start, 30, 20, 0.1)
+	for i := range steady {
+		steady[i].Value += float64(i%2) * 0.02
+	}
+	last := steady[len(steady)-1]
+
+	tests := []struct {
+		name  string
+		s     Series
+		spike []int64
+	}{
+		{"steady", steady, nil},
+		{"spike", append(steady[:30:30], Sample{last.Time + 600, last.Value + 2}), []int64{last.Time + 600}},
+		{"slow change", append(steady[:30:30], Sample{last.Time + 600, last.Value + 0.4}), nil},
+		{"short history", append(steady[:5:5], Sample{steady[4].Time + 600, steady[4].Value + 2}), nil},
+		// spike is not added to statistics, so return is spike too
+		{"spike and return", append(steady[:30:30], Sample{last.Time + 600, last.Value + 2}, Sample{last.Time + 1200, last.Value + 0.2}),
+			[]int64{last.Time + 600, last.Time + 1200}},
+	}
+	for _, tt := range tests {
+		var got []int64
+		for _, a := range DetectSpikes("room", tt.s, AnomalyOptions{}) {
+			if a.Kind != AnomalySpike || a.Sensor != "room" || a.Score < 4 {
+				t.Errorf("%s: got %+v", tt.name, a)
+			}
+			got = append(got, a.Time.Unix())
+		}
+		if len(got) != len(tt.spike) {
+			t.Errorf("%s: spikes at %v, want %v", tt.name, got, tt.spike)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.spike[i] {
+				t.Errorf("%s: spikes at %v, want %v", tt.name, got, tt.spike)
+			}
+		}
+	}
+}
+
+func TestDetectHourlyDeviation(t *testing.T) {
+	start := time.Date(2023, 11, 6, 0, 0, 0, 0, time.UTC).Unix()
+	history := func(last float64, days int) Series {
+		var s Series
+		for h := 0; h < days*24; h++ {
+			// same hour of different days differ by 0.2 °C
+			s = append(s, Sample{Time: start + int64(h)*3600 + 60, Value: 20 + float64(h%24)*0.1 + float64(h/24%2)*0.2})
+		}
+		s = append(s, Sample{Time: start + int64(days*24)*3600 + 60, Value: last})
+		return s
+	}
+	// last sample is at hour 0 of day 7, 3 of 7 previous days are warmer
+	usual := 20.2
+	mean := 20 + 0.2*3/7
+
+	tests := []struct {
+		name  string
+		s     Series
+		found bool
+	}{
+		{"usual", history(usual, 7), false},
+		{"deviation", history(usual+5, 7), true},
+		// far in standard deviations, but less than MinDeviation
+		{"small deviation", history(usual+1, 7), false},
+		{"short history", history(usual+5, 2), false},
+	}
+	for _, tt := range tests {
+		anomalies := DetectHourlyDeviation("room", tt.s, AnomalyOptions{})
+		if !tt.found {
+			if len(anomalies) != 0 {
+				t.Errorf("%s: got %+v", tt.name, anomalies)
+			}
+			continue
+		}
+		if len(anomalies) != 1 {
+			t.Fatalf("%s: got %+v, want one anomaly", tt.name, anomalies)
+		}
+		a := anomalies[0]
+		last := tt.s[len(tt.s)-1]
+		if a.Kind != AnomalyHourly || a.Time.Unix() != last.Time-60 || a.Value != last.Value {
+			t.Errorf("%s: got %+v, want hour of last sample", tt.name, a)
+		}
+		if math.Abs(a.Expected-mean) > 1e-9 {
+			t.Errorf("%s: expected %v, want mean of previous days %v", tt.name, a.Expected, mean)
+		}
+	}
+}
+
+func TestDetectNoResponse(t *testing.T) {
+	start := int64(1700000000)
+	flat := steadySeries(start, 30, 20, 0)
+	warming := steadySeries(start, 30, 20, 0.1)
+	increase := Series{{Time: start, Value: 18}, {Time: start + 600, Value: 22}}
+
+	tests := []struct {
+		name   string
+		room   Series
+		target Series
+		found  bool
+	}{
+		{"no response", flat, increase, true},
+		{"warming", warming, increase, false},
+		{"small step", flat, Series{{Time: start, Value: 20}, {Time: start + 600, Value: 20.5}}, false},
+		{"decrease", flat, Series{{Time: start, Value: 22}, {Time: start + 600, Value: 18}}, false},
+		{"not enough data", flat[:10], increase, false},
+		{"changed back", flat, append(increase[:2:2], Sample{Time: start + 1800, Value: 18}), false},
+		{"no room data", nil, increase, false},
+	}
+	for _, tt := range tests {
+		anomalies := DetectNoResponse("room", tt.room, tt.target, AnomalyOptions{})
+		if !tt.found {
+			if len(anomalies) != 0 {
+				t.Errorf("%s: got %+v", tt.name, anomalies)
+			}
+			continue
+		}
+		if len(anomalies) != 1 {
+			t.Errorf("%s: got %+v, want one anomaly", tt.name, anomalies)
+			continue
+		}
+		a := anomalies[0]
+		if a.Kind != AnomalyNoResponse || a.Time.Unix() != start+600 || a.Score != 0 || a.Expected != 20.5 {
+			t.Errorf("%s: got %+v", tt.name, a)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package zont
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one state changing call of Client
+type AuditRecord struct {
+	Time          time.Time     `json:"time"`
+	Username      string        `json:"username"`
+	DeviceID      int           `json:"device_id"`
+	Operation     string        `json:"operation"`
+	CorrelationID string        `json:"correlation_id"`
+	Payload       interface{}   `json:"payload"`
+	Diff          []FieldChange `json:"diff,omitempty"`
+	Result        string        `json:"result"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// Audit results
+const (
+	AuditOk     = "ok"
+	AuditFailed = "failed"
+	AuditDryRun = "dry_run"
+)
+
+// AuditSink receive audit records of every write
+type AuditSink interface {
+	Record(AuditRecord) error
+}
+
+// AuditFunc is AuditSink calling function
+type AuditFunc func(AuditRecord) error
+
+func (f AuditFunc) Record(r AuditRecord) error {
+	return f(r)
+}
+
+// JSONLinesAudit write records as JSON lines
+type JSONLinesAudit struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	f   *os.File
+}
+
+// NewJSONLinesAudit return sink writing to w
+func NewJSONLinesAudit(w io.Writer) *JSONLinesAudit {
+	return &JSONLinesAudit{enc: json.NewEncoder(w)}
+}
+
+// OpenAuditFile return sink appending to file path
+func OpenAuditFile(path string) (*JSONLinesAudit, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	a := NewJSONLinesAudit(f)
+	a.f = f
+	return a, nil
+}
+
+func (a *JSONLinesAudit) Record(r AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(r); err != nil {
+		return err
+	}
+	if a.f != nil {
+		return a.f.Sync()
+	}
+	return nil
+}
+
+// Close close file opened by OpenAuditFile
+func (a *JSONLinesAudit) Close() error {
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+// MultiAudit send records to every sink
+type MultiAudit []AuditSink
+
+func (m MultiAudit) Record(r AuditRecord) error {
+	var first error
+	for _, sink := range m {
+		if err := sink.Record(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ErrAuditFailed is returned by successful write when audit sink failed to record
+// it, write itself was sent but not confirmed. Error of failed write is returned
+// as is and audit error is only logged then.
+var ErrAuditFailed = errors.New("audit record failed")
+
+// SetAuditSink set sink receiving record of every write, nil disable audit. Record
+// error of sink is returned by write wrapped in ErrAuditFailed.
+func (cl *Client) SetAuditSink(sink AuditSink) {
+	cl.audit = sink
+}
+
+// WithCorrelationID set correlation id of audit record, random id is used otherwise
+func WithCorrelationID(id string) WriteOption {
+	return func(o *writeOptions) {
+		o.correlationID = id
+	}
+}
+
+// payloadDiff compare payload of write with device, device is loaded when it is
+// not cached. Only fields of payload are compared.
+func (cl *Client) payloadDiff(data interface{}) []FieldChange {
+	payload, ok := jsonValue(data).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	deviceId, ok := toFloat(payload["device_id"])
+	if !ok {
+		return nil
+	}
+	d, err := cl.Device(int(deviceId))
+	if err != nil {
+		ContextLogger.Error(err)
+		return nil
+	}
+
+	before := rawMap(d)
+	var changes []FieldChange
+	for key, value := range payload {
+		if key == "device_id" {
+			continue
+		}
+		changes = append(changes, diffPresent(key, before[key], value)...)
+	}
+	return changes
+}
+
+// diffPresent is diffValues comparing only keys present in new
+func diffPresent(path string, old, new interface{}) []FieldChange {
+	oldMap, oldOk := old.(map[string]interface{})
+	newMap, newOk := new.(map[string]interface{})
+	if !oldOk || !newOk {
+		return diffValues(path, old, new)
+	}
+	var changes []FieldChange
+	for key, value := range newMap {
+		changes = append(changes, diffPresent(path+"."+key, oldMap[key], value)...)
+	}
+	return changes
+}
+
+// auditWrite send record of update_device call to audit sink, error of sink is
+// returned wrapped in ErrAuditFailed
+func (cl *Client) auditWrite(operation string, options *writeOptions, data interface{}, err error) error {
+	if cl.audit == nil {
+		return nil
+	}
+
+	payload := map[string]interface{}{}
+	raw, marshalErr := json.Marshal(data)
+	if marshalErr == nil {
+		marshalErr = json.Unmarshal(raw, &payload)
+	}
+	if marshalErr != nil {
+		ContextLogger.Error(marshalErr)
+	}
+	deviceId, _ := toFloat(payload["device_id"])
+
+	record := AuditRecord{
+		Time:          time.Now().UTC(),
+		DeviceID:      int(deviceId),
+		Operation:     operation,
+		CorrelationID: options.correlationID,
+		Payload:       payload,
+		Diff:          options.diff,
+		Result:        AuditOk,
+	}
+	if cl.AuthTokenResponse != nil {
+		record.Username = cl.AuthTokenResponse.Username
+	}
+	if err != nil {
+		record.Result = AuditFailed
+		record.Error = err.Error()
+	} else if options.dryRun {
+		record.Result = AuditDryRun
+	}
+
+	if err := cl.audit.Record(record); err != nil {
+		err = fmt.Errorf("%w: %w", ErrAuditFailed, err)
+		ContextLogger.Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package zont
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ownWriteWindow = 15 * time.Minute
+
+// Change sources of ConfigChange
+const (
+	ChangeExternal = "external"
+	ChangeOwn      = "own"
+)
+
+// ConfigChange is change of device configuration found by WatchConfig
+type ConfigChange struct {
+	DeviceID   int         `json:"device_id"`
+	DeviceName string      `json:"device_name"`
+	Path       string      `json:"path"`
+	Old        interface{} `json:"old"`
+	New        interface{} `json:"new"`
+	FirstSeen  time.Time   `json:"first_seen"`
+	// Source is ChangeOwn for changes written by this client, ChangeExternal otherwise
+	Source string `json:"source"`
+	// ChangedBy is account of client for own changes, ZONT API does not tell
+	// who made external changes
+	ChangedBy string `json:"changed_by,omitempty"`
+}
+
+// writeLog remember values written by client to tell own changes from external ones
+type writeLog struct {
+	mu      sync.Mutex
+	entries []writeEntry
+}
+
+type writeEntry struct {
+	deviceId int
+	payload  map[string]interface{}
+	time     time.Time
+}
+
+// record remember update_device payload
+func (l *writeLog) record(data interface{}) {
+	payload := map[string]interface{}{}
+	raw, err := json.Marshal(data)
+	if err == nil {
+		err = json.Unmarshal(raw, &payload)
+	}
+	if err != nil {
+		return
+	}
+	deviceId, _ := toFloat(payload["device_id"])
+
+	entry := writeEntry{deviceId: int(deviceId), payload: payload, time: time.Now()}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := l.entries[:0]
+	for _, e := range l.entries {
+		if time.Since(e.time) < ownWriteWindow {
+			kept = append(kept, e)
+		}
+	}
+	l.entries = append(kept, entry)
+}
+
+// own return true when the latest recent write of field of device set it to value
+func (l *writeLog) own(deviceId int, path string, value interface{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e := l.entries[i]
+		if e.deviceId != deviceId || time.Since(e.time) >= ownWriteWindow {
+			continue
+		}
+		if written, ok := lookupPath(e.payload, path); ok {
+			return reflect.DeepEqual(written, value)
+		}
+	}
+	return false
+}
+
+// lookupPath return value at dotted path of decoded JSON object
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// DiffConfig return field level changes between configuration snapshots
+func DiffConfig(old, new *ConfigSnapshot) []FieldChange {
+	var changes []FieldChange
+	keys := map[string]bool{}
+	oldFields := map[string]interface{}{}
+	newFields := map[string]interface{}{}
+	for _, values := range old.Sections {
+		for key, value := range values {
+			oldFields[key] = value
+			keys[key] = true
+		}
+	}
+	for _, values := range new.Sections {
+		for key, value := range values {
+			newFields[key] = value
+			keys[key] = true
+		}
+	}
+	for key := range keys {
+		changes = append(changes, diffValues(key, oldFields[key], newFields[key])...)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+const defaultConfigWatchInterval = 5 * time.Minute
+
+// WatchConfig snapshot configuration of all devices every interval (five minutes
+// when not set) and call handler for every changed field until ctx is done
+func (cl *Client) WatchConfig(ctx context.Context, interval time.Duration, handler func(ConfigChange)) {
+	if interval <= 0 {
+		interval = defaultConfigWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := map[int]*ConfigSnapshot{}
+	for {
+		cl.auditConfig(previous, handler)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cl *Client) auditConfig(previous map[int]*ConfigSnapshot, handler func(ConfigChange)) {
+	if cl.AuthTokenResponse == nil || len(cl.AuthTokenResponse.Token) < 1 {
+		ContextLogger.Infoln("AuthToken not exist!")
+		return
+	}
+	resp := cl.GetDevices()
+	if resp == nil || !resp.Ok {
+		return
+	}
+
+	now := time.Now()
+	for i := range resp.Devices {
+		d := &resp.Devices[i]
+		current := Snapshot(d)
+		old, ok := previous[d.ID]
+		previous[d.ID] = current
+		if !ok {
+			continue
+		}
+
+		for _, c := range DiffConfig(old, current) {
+			change := ConfigChange{
+				DeviceID:   d.ID,
+				DeviceName: d.Name,
+				Path:       c.Path,
+				Old:        c.Old,
+				New:        c.New,
+				FirstSeen:  now,
+				Source:     ChangeExternal,
+			}
+			if cl.writes.own(d.ID, c.Path, c.New) {
+				change.Source = ChangeOwn
+				change.ChangedBy = cl.AuthTokenResponse.Username
+			}
+			handler(change)
+		}
+	}
+}
+
+// JSONLinesChanges return handler writing every change as JSON line to w
+func JSONLinesChanges(w io.Writer) func(ConfigChange) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(c ConfigChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(c); err != nil {
+			ContextLogger.Error(err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package zont
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuditFailedWrites(t *testing.T) {
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"access_denied"}`))
+	}))
+	var records []AuditRecord
+	cl.SetAuditSink(AuditFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	payload := map[string]interface{}{"device_id": 7}
+	if err := cl.UpdateDevice(payload, WithCorrelationID("rejected")); err == nil {
+		t.Error("rejected write returned nil")
+	}
+	cl.AuthTokenResponse.Token = ""
+	if err := cl.UpdateDevice(payload, WithCorrelationID("no-token")); err == nil {
+		t.Error("write without token returned nil")
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	for i, id := range []string{"rejected", "no-token"} {
+		r := records[i]
+		if r.CorrelationID != id || r.Result != AuditFailed || r.DeviceID != 7 || r.Error == "" {
+			t.Errorf("record %d: %+v", i, r)
+		}
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t,
+		`{"ok":true,"devices":[{"id":7,"thermostat_enable_guard":false,"thermostat_ext_mode":1,"pump":{"delay":30}}]}`, &updates))
+	var records []AuditRecord
+	cl.SetAuditSink(AuditFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	if err := cl.SetGuard(7, true); err != nil {
+		t.Fatal(err)
+	}
+	p, err := cl.NewPatch(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Set("pump", map[string]interface{}{"delay": 60})
+	if err := cl.ApplyPatch(p); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"thermostat_enable_guard: false -> true",
+		"pump.delay: 30 -> 60",
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, r := range records {
+		if len(r.Diff) != 1 || r.Diff[0].String() != want[i] {
+			t.Errorf("record %s diff = %v, want %s", r.Operation, r.Diff, want[i])
+		}
+	}
+}
+
+func TestAuditSinkError(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[{"id":7}]}`, &updates))
+	cl.SetAuditSink(AuditFunc(func(r AuditRecord) error {
+		return errors.New("disk full")
+	}))
+
+	err := cl.SetExtMode(7, 2)
+	if !errors.Is(err, ErrAuditFailed) || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("got %v, want audit error", err)
+	}
+	if WriteStatusOf(err) != WriteSent || updates != 1 {
+		t.Errorf("status %s with %d updates, want sent", WriteStatusOf(err), updates)
+	}
+}
+
+func TestWriteLogOwn(t *testing.T) {
+	l := &writeLog{}
+	l.record(map[string]interface{}{
+		"device_id": 7,
+		"z3k_config": map[string]interface{}{
+			"heating_zones": []interface{}{map[string]interface{}{"id": 1}},
+			"ot":            map[string]interface{}{"max_setpoint": 80},
+		},
+	})
+	l.record(map[string]interface{}{"device_id": 7, "name": "first"})
+	l.record(map[string]interface{}{"device_id": 7, "name": "second"})
+
+	tests := []struct {
+		deviceId int
+		path     string
+		value    interface{}
+		own      bool
+	}{
+		{7, "z3k_config.ot.max_setpoint", float64(80), true},
+		{7, "z3k_config.ot.max_setpoint", float64(70), false},
+		{7, "z3k_config.ot.min_setpoint", float64(30), false},
+		{7, "z3k_config.heating_zones", []interface{}{map[string]interface{}{"id": float64(1)}}, true},
+		{7, "name", "second", true},
+		{7, "name", "first", false},
+		{7, "timezone", float64(3), false},
+		{8, "name", "second", false},
+	}
+	for _, tt := range tests {
+		if got := l.own(tt.deviceId, tt.path, tt.value); got != tt.own {
+			t.Errorf("own(%d, %s, %v) = %v, want %v", tt.deviceId, tt.path, tt.value, got, tt.own)
+		}
+	}
+}
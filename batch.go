@@ -0,0 +1,195 @@
+package zont
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	defaultBatchPerRequest = 10
+	defaultBatchWorkers    = 4
+)
+
+// DataResponse is load_data response of one device with any of supported data types.
+// Only envelope and temperature are typed, other data types like thermostat_work can
+// have fractional values in any field and are read from Raw with History.
+type DataResponse struct {
+	DeviceID      int                        `json:"device_id"`
+	Ok            bool                       `json:"ok"`
+	TimeTruncated bool                       `json:"time_truncated"`
+	Error         string                     `json:"error,omitempty"`
+	Temperature   map[string]TemperatureData `json:"temperature,omitempty"`
+	// Raw is full device response for data types without typed fields
+	Raw json.RawMessage `json:"-"`
+}
+
+type loadDataRawResponse struct {
+	Ok        bool              `json:"ok"`
+	Error     string            `json:"error,omitempty"`
+	Responses []json.RawMessage `json:"responses"`
+}
+
+// BatchRequest is load_data request for many devices
+type BatchRequest struct {
+	DeviceIDs []int
+	DataTypes []string
+	MinTime   int64
+	MaxTime   int64
+	// PerRequest is max devices packed into one load_data call, 10 by default
+	PerRequest int
+	// Workers is max concurrent load_data calls, 4 by default
+	Workers int
+}
+
+// BatchResult is load_data result of one device from batch
+type BatchResult struct {
+	DeviceID int
+	Data     *DataResponse
+	Err      error
+}
+
+// LoadDataRaw send load_data request with many device requests and return
+// responses by device id
+func (cl *Client) LoadDataRaw(data LoadDataRequest) (map[int]*DataResponse, error) {
+	if cl.AuthTokenResponse == nil || len(cl.AuthTokenResponse.Token) < 1 {
+		return nil, errors.New("AuthToken not exist")
+	}
+
+	method := "load_data"
+	uri := cl.baseUrl + method
+
+	body := cl.PostRequestHandler(data, uri, false)
+	if body == nil {
+		return nil, errors.New("load_data request failed")
+	}
+
+	raw := loadDataRawResponse{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	if !raw.Ok && len(raw.Responses) == 0 {
+		return nil, fmt.Errorf("load_data failed: %s", raw.Error)
+	}
+
+	responses := map[int]*DataResponse{}
+	for _, r := range raw.Responses {
+		resp := &DataResponse{Raw: r}
+		if err := json.Unmarshal(r, resp); err != nil {
+			ContextLogger.Error(err)
+			continue
+		}
+		responses[resp.DeviceID] = resp
+	}
+	return responses, nil
+}
+
+// LoadDataBatch load data of many devices packing them into as few load_data calls
+// as allowed by PerRequest and running calls concurrently. Result of every device is
+// returned separately, failed device does not fail others.
+func (cl *Client) LoadDataBatch(ctx context.Context, batch BatchRequest) map[int]*BatchResult {
+	perRequest := batch.PerRequest
+	if perRequest < 1 {
+		perRequest = defaultBatchPerRequest
+	}
+	workers := batch.Workers
+	if workers < 1 {
+		workers = defaultBatchWorkers
+	}
+
+	var chunks [][]int
+	for start := 0; start < len(batch.DeviceIDs); start += perRequest {
+		end := start + perRequest
+		if end > len(batch.DeviceIDs) {
+			end = len(batch.DeviceIDs)
+		}
+		chunks = append(chunks, batch.DeviceIDs[start:end])
+	}
+
+	results := map[int]*BatchResult{}
+	var mu sync.Mutex
+	store := func(r *BatchResult) {
+		mu.Lock()
+		results[r.DeviceID] = r
+		mu.Unlock()
+	}
+
+	jobs := make(chan []int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ids := range jobs {
+				for _, r := range cl.loadDataChunk(ctx, batch, ids) {
+					store(r)
+				}
+			}
+		}()
+	}
+
+	for _, ids := range chunks {
+		jobs <- ids
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// loadDataChunk load one packed request, if whole request fails devices are loaded one by one
+func (cl *Client) loadDataChunk(ctx context.Context, batch BatchRequest, ids []int) []*BatchResult {
+	if err := ctx.Err(); err != nil {
+		return failedResults(ids, err)
+	}
+
+	request := LoadDataRequest{}
+	for _, id := range ids {
+		request.Requests = append(request.Requests, DataRequest{
+			DeviceID:  id,
+			DataTypes: batch.DataTypes,
+			MinTime:   batch.MinTime,
+			MaxTime:   batch.MaxTime,
+		})
+	}
+
+	responses, err := cl.LoadDataRaw(request)
+	if err != nil {
+		if len(ids) == 1 {
+			return failedResults(ids, err)
+		}
+		ContextLogger.Infoln("load_data batch failed, loading devices separately:", err)
+		var results []*BatchResult
+		for _, id := range ids {
+			results = append(results, cl.loadDataChunk(ctx, batch, []int{id})...)
+		}
+		return results
+	}
+
+	results := make([]*BatchResult, 0, len(ids))
+	for _, id := range ids {
+		r := &BatchResult{DeviceID: id}
+		resp, ok := responses[id]
+		switch {
+		case !ok:
+			r.Err = fmt.Errorf("no load_data response for device %d", id)
+		case !resp.Ok:
+			r.Err = fmt.Errorf("load_data failed for device %d: %s", id, resp.Error)
+			r.Data = resp
+		default:
+			r.Data = resp
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func failedResults(ids []int, err error) []*BatchResult {
+	results := make([]*BatchResult, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, &BatchResult{DeviceID: id, Err: err})
+	}
+	return results
+}
@@ -0,0 +1,196 @@
+package zont
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadDataRawFractionalThermostatWork(t *testing.T) {
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"responses":[{"device_id":7,"ok":true,
+			"thermostat_work":{"target_temp":[[1700000000,21.5]],
+			"zones":{"1":{"target_temp":[[1700000000,22.5],[60,23]]}},
+			"ot":{"rml":[[1700000000,37.5]]},"boiler_work_time":[[1700000000,0.5]]}}]}`))
+	}))
+
+	responses, err := cl.LoadDataRaw(LoadDataRequest{Requests: []DataRequest{{DeviceID: 7}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := responses[7]
+	if !ok {
+		t.Fatal("response of device 7 is dropped")
+	}
+
+	h := resp.History()
+	tests := []struct {
+		key  string
+		time int64
+		want float64
+	}{
+		{"thermostat_work/target_temp", 1700000000, 21.5},
+		{"thermostat_work/zones/1/target_temp", 1700000060, 23},
+		{"thermostat_work/ot/rml", 1700000000, 37.5},
+		{"thermostat_work/boiler_work_time", 1700000000, 0.5},
+	}
+	for _, tt := range tests {
+		last, ok := h.Series[tt.key].Last()
+		if !ok {
+			t.Errorf("%s: no samples", tt.key)
+			continue
+		}
+		if last.Time != tt.time || last.Value != tt.want {
+			t.Errorf("%s: got %d %v, want %d %v", tt.key, last.Time, last.Value, tt.time, tt.want)
+		}
+	}
+}
+
+// batchHandler answer load_data requests with temperature of every requested device,
+// device 3 fails alone and any request with device 13 fails as whole
+type batchHandler struct {
+	mu       sync.Mutex
+	requests [][]int
+	active   int
+	peak     int
+}
+
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request LoadDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.Write([]byte(`{"ok":false,"error":"bad_request"}`))
+		return
+	}
+	var ids []int
+	for _, dr := range request.Requests {
+		ids = append(ids, dr.DeviceID)
+	}
+
+	h.mu.Lock()
+	h.requests = append(h.requests, ids)
+	h.active++
+	if h.active > h.peak {
+		h.peak = h.active
+	}
+	h.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	defer func() {
+		h.mu.Lock()
+		h.active--
+		h.mu.Unlock()
+	}()
+
+	var responses []string
+	for _, id := range ids {
+		switch id {
+		case 13:
+			w.Write([]byte(`{"ok":false,"error":"internal_error"}`))
+			return
+		case 3:
+			responses = append(responses, `{"device_id":3,"ok":false,"error":"device_not_found"}`)
+		default:
+			responses = append(responses, fmt.Sprintf(`{"device_id":%d,"ok":true,"temperature":{"4096":{"temperature":[[1700000000,%d]]}}}`, id, id))
+		}
+	}
+	fmt.Fprintf(w, `{"ok":true,"responses":[%s]}`, strings.Join(responses, ","))
+}
+
+func TestLoadDataBatch(t *testing.T) {
+	h := &batchHandler{}
+	cl := newTestClient(t, h)
+
+	var ids []int
+	for id := 1; id <= 12; id++ {
+		ids = append(ids, id)
+	}
+	results := cl.LoadDataBatch(context.Background(), BatchRequest{
+		DeviceIDs:  ids,
+		DataTypes:  []string{"temperature"},
+		PerRequest: 3,
+		Workers:    2,
+	})
+
+	if len(h.requests) != 4 {
+		t.Errorf("got %d load_data calls, want 4", len(h.requests))
+	}
+	for _, r := range h.requests {
+		if len(r) > 3 {
+			t.Errorf("request with %d devices, want at most 3", len(r))
+		}
+	}
+	if h.peak > 2 {
+		t.Errorf("%d concurrent load_data calls, want at most 2", h.peak)
+	}
+
+	if len(results) != len(ids) {
+		t.Fatalf("got %d results, want %d", len(results), len(ids))
+	}
+	for _, id := range ids {
+		r := results[id]
+		if r == nil || r.DeviceID != id {
+			t.Errorf("device %d: result %+v", id, r)
+			continue
+		}
+		if id == 3 {
+			if r.Err == nil {
+				t.Error("device 3: failed response is not reported")
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("device %d: %v", id, r.Err)
+			continue
+		}
+		last, ok := r.Data.History().Series["temperature/4096"].Last()
+		if !ok || last.Value != float64(id) {
+			t.Errorf("device %d: got %+v of other device", id, last)
+		}
+	}
+}
+
+func TestLoadDataBatchFailedRequest(t *testing.T) {
+	h := &batchHandler{}
+	cl := newTestClient(t, h)
+
+	results := cl.LoadDataBatch(context.Background(), BatchRequest{
+		DeviceIDs:  []int{12, 13, 14},
+		DataTypes:  []string{"temperature"},
+		PerRequest: 3,
+	})
+
+	// failed request is repeated for every device alone
+	if len(h.requests) != 4 {
+		t.Errorf("got %d load_data calls, want 4", len(h.requests))
+	}
+	if results[13] == nil || results[13].Err == nil {
+		t.Errorf("device 13: got %+v, want error", results[13])
+	}
+	for _, id := range []int{12, 14} {
+		if r := results[id]; r == nil || r.Err != nil || r.Data == nil {
+			t.Errorf("device %d: got %+v, want data", id, r)
+		}
+	}
+}
+
+func TestLoadDataBatchCanceled(t *testing.T) {
+	h := &batchHandler{}
+	cl := newTestClient(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := cl.LoadDataBatch(ctx, BatchRequest{DeviceIDs: []int{1, 2}})
+
+	if len(h.requests) != 0 {
+		t.Errorf("got %d load_data calls after cancel", len(h.requests))
+	}
+	for _, id := range []int{1, 2} {
+		if r := results[id]; r == nil || r.Err != context.Canceled {
+			t.Errorf("device %d: got %+v, want %v", id, r, context.Canceled)
+		}
+	}
+}
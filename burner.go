@@ -0,0 +1,267 @@
+package zont
+
+import (
+	"sort"
+	"time"
+)
+
+// OpenTherm slave status flags of thermostat_work ot.s
+const (
+	OtStatusFault = 1 << 0
+	OtStatusCH    = 1 << 1
+	OtStatusDHW   = 1 << 2
+	OtStatusFlame = 1 << 3
+)
+
+// BurnerOptions set short-cycling detection and day boundaries of AnalyzeBurner
+type BurnerOptions struct {
+	// MinRunTime is shortest normal burner run, shorter runs are short cycles. 10 minutes by default
+	MinRunTime time.Duration
+	// ShortCycleStarts short runs within ShortCycleWindow make short-cycling episode. 3 by default
+	ShortCycleStarts int
+	// ShortCycleWindow is one hour by default
+	ShortCycleWindow time.Duration
+	// Location of day boundaries, device local days (Device.Location) by default
+	Location *time.Location
+}
+
+// BurnerDay is burner statistics of one day
+type BurnerDay struct {
+	Day     time.Time
+	OnHours float64
+	Starts  int
+	// AvgModulation is time weighted average of ot.rml while flame is on, percent
+	AvgModulation float64
+	ShortCycles   int
+	HeatingHours  float64
+	DhwHours      float64
+	// DhwShare is part of burner time spent on hot water, 0 - 1
+	DhwShare float64
+	Faults   int
+	// CounterHours is growth of boiler_work_time counter
+	CounterHours float64
+}
+
+// BurnerRun is one continuous burner run
+type BurnerRun struct {
+	Start time.Time
+	End   time.Time
+	Dhw   bool
+}
+
+// ShortCycle is episode of frequent short burner runs
+type ShortCycle struct {
+	Start time.Time
+	End   time.Time
+	Runs  int
+}
+
+// BurnerReport is result of AnalyzeBurner
+type BurnerReport struct {
+	DeviceID    int
+	Days        []BurnerDay
+	Runs        []BurnerRun
+	ShortCycles []ShortCycle
+}
+
+// burnerSegment is state of burner between two samples
+type burnerSegment struct {
+	start, end int64
+	flame, dhw bool
+}
+
+// AnalyzeBurner compute daily burner statistics from thermostat_work history of d.
+// Flame is taken from ot.s flame bit, power series is used for boilers without OpenTherm.
+func AnalyzeBurner(d *Device, h *History, opts BurnerOptions) *BurnerReport {
+	if opts.MinRunTime <= 0 {
+		opts.MinRunTime = 10 * time.Minute
+	}
+	if opts.ShortCycleStarts <= 0 {
+		opts.ShortCycleStarts = 3
+	}
+	if opts.ShortCycleWindow <= 0 {
+		opts.ShortCycleWindow = time.Hour
+	}
+	if opts.Location == nil {
+		opts.Location = deviceLocation(d)
+	}
+
+	report := &BurnerReport{DeviceID: h.DeviceID}
+	days := map[time.Time]*BurnerDay{}
+	dayOf := func(start time.Time) *BurnerDay {
+		d, ok := days[start]
+		if !ok {
+			d = &BurnerDay{Day: start}
+			days[start] = d
+		}
+		return d
+	}
+	day := func(t int64) *BurnerDay {
+		return dayOf(dayStart(t, opts.Location))
+	}
+
+	segments := burnerSegments(h)
+	modulation := h.Series["thermostat_work/ot/rml"]
+	modulationWeight := map[time.Time]float64{}
+
+	// runs and per day time
+	var run *BurnerRun
+	for _, seg := range segments {
+		if seg.flame {
+			if run == nil {
+				run = &BurnerRun{Start: time.Unix(seg.start, 0), Dhw: seg.dhw}
+				day(seg.start).Starts++
+			}
+			run.End = time.Unix(seg.end, 0)
+			run.Dhw = run.Dhw || seg.dhw
+
+			dhw := seg.dhw
+			splitDays(seg.start, seg.end, opts.Location, func(start time.Time, from, to int64) {
+				d := dayOf(start)
+				hours := float64(to-from) / 3600
+				d.OnHours += hours
+				if dhw {
+					d.DhwHours += hours
+				} else {
+					d.HeatingHours += hours
+				}
+				if len(modulation) > 0 {
+					sum, covered := integrate(modulation, from, to)
+					d.AvgModulation += sum
+					modulationWeight[d.Day] += covered
+				}
+			})
+		} else if run != nil {
+			report.Runs = append(report.Runs, *run)
+			run = nil
+		}
+	}
+	if run != nil {
+		report.Runs = append(report.Runs, *run)
+	}
+
+	// short cycles
+	var short []BurnerRun
+	flush := func() {
+		if len(short) >= opts.ShortCycleStarts {
+			report.ShortCycles = append(report.ShortCycles, ShortCycle{
+				Start: short[0].Start,
+				End:   short[len(short)-1].End,
+				Runs:  len(short),
+			})
+		}
+		short = nil
+	}
+	for _, r := range report.Runs {
+		if r.End.Sub(r.Start) >= opts.MinRunTime {
+			continue
+		}
+		day(r.Start.Unix()).ShortCycles++
+		if len(short) > 0 && r.Start.Sub(short[0].Start) > opts.ShortCycleWindow {
+			flush()
+		}
+		short = append(short, r)
+	}
+	flush()
+
+	// faults are counted on rising edge of fail
+	fail := h.Series["thermostat_work/fail"]
+	for i, s := range fail {
+		if s.Value != 0 && (i == 0 || fail[i-1].Value == 0) {
+			day(s.Time).Faults++
+		}
+	}
+
+	counter := h.Series["thermostat_work/boiler_work_time"]
+	for i := 1; i < len(counter); i++ {
+		if delta := counter[i].Value - counter[i-1].Value; delta > 0 {
+			day(counter[i].Time).CounterHours += delta / 3600
+		}
+	}
+
+	for _, d := range days {
+		if w := modulationWeight[d.Day]; w > 0 {
+			d.AvgModulation /= w
+		}
+		if d.OnHours > 0 {
+			d.DhwShare = d.DhwHours / d.OnHours
+		}
+		report.Days = append(report.Days, *d)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day.Before(report.Days[j].Day) })
+
+	return report
+}
+
+// burnerSegments return burner state between samples of ot.s or power series
+func burnerSegments(h *History) []burnerSegment {
+	status, ot := h.Series["thermostat_work/ot/s"]
+	if !ot || len(status) == 0 {
+		status = h.Series["thermostat_work/power"]
+		ot = false
+	}
+
+	segments := make([]burnerSegment, 0, len(status))
+	for i := 0; i+1 < len(status); i++ {
+		seg := burnerSegment{start: status[i].Time, end: status[i+1].Time}
+		if ot {
+			flags := int(status[i].Value)
+			seg.flame = flags&OtStatusFlame != 0
+			seg.dhw = flags&OtStatusDHW != 0
+		} else {
+			seg.flame = status[i].Value != 0
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// integrate return integral of series step function on [from, to) and
+// covered time, time before first sample is not covered
+func integrate(s Series, from, to int64) (sum, covered float64) {
+	for i, sample := range s {
+		end := to
+		if i+1 < len(s) && s[i+1].Time < to {
+			end = s[i+1].Time
+		}
+		start := sample.Time
+		if start < from {
+			start = from
+		}
+		if start >= to {
+			break
+		}
+		if end > start {
+			sum += sample.Value * float64(end-start)
+			covered += float64(end - start)
+		}
+	}
+	return sum, covered
+}
+
+// deviceLocation return Device.Location of d, UTC without device
+func deviceLocation(d *Device) *time.Location {
+	if d == nil {
+		return time.UTC
+	}
+	return d.Location()
+}
+
+// dayStart return start of day in loc containing unix time t
+func dayStart(t int64, loc *time.Location) time.Time {
+	local := time.Unix(t, 0).In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// splitDays call fn for every part of [from, to) inside one day in loc
+func splitDays(from, to int64, loc *time.Location, fn func(day time.Time, from, to int64)) {
+	for from < to {
+		start := dayStart(from, loc)
+		end := start.AddDate(0, 0, 1).Unix()
+		if end > to {
+			end = to
+		}
+		fn(start, from, end)
+		from = end
+	}
+}
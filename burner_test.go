@@ -0,0 +1,48 @@
+package zont
+
+import (
+	"testing"
+	"time"
+)
+
+// localDayHistory has one hour of burner work from 01:00 of 2023-11-15 in UTC+5,
+// which is 20:00 of 2023-11-14 in UTC
+func localDayHistory() (*Device, *History) {
+	d := &Device{}
+	d.ID = 7
+	d.Timezone = 5
+
+	start := time.Date(2023, 11, 14, 20, 0, 0, 0, time.UTC).Unix()
+	h := NewHistory(7)
+	h.Series["thermostat_work/ot/s"] = Series{
+		{Time: start, Value: OtStatusFlame | OtStatusCH},
+		{Time: start + 3600, Value: 0},
+		{Time: start + 7200, Value: 0},
+	}
+	h.Series["temperature/t1"] = Series{
+		{Time: start, Value: 20},
+		{Time: start + 600, Value: 20.1},
+	}
+	return d, h
+}
+
+func TestAnalyzeBurnerDeviceLocalDays(t *testing.T) {
+	d, h := localDayHistory()
+	report := AnalyzeBurner(d, h, BurnerOptions{})
+	if len(report.Days) != 1 {
+		t.Fatalf("got %d days, want 1", len(report.Days))
+	}
+	day := report.Days[0]
+	want := time.Date(2023, 11, 15, 0, 0, 0, 0, d.Location())
+	if !day.Day.Equal(want) || day.Day.Location().String() != d.Location().String() {
+		t.Errorf("day = %v, want %v", day.Day, want)
+	}
+	if day.OnHours != 1 || day.Starts != 1 {
+		t.Errorf("on hours %v starts %d", day.OnHours, day.Starts)
+	}
+
+	utc := AnalyzeBurner(d, h, BurnerOptions{Location: time.UTC})
+	if got := utc.Days[0].Day; !got.Equal(time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("explicit UTC day = %v", got)
+	}
+}
@@ -3,6 +3,8 @@ package zont
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -11,7 +13,7 @@ import (
 )
 
 const (
-	baseUrl = "https://zont-online.ru/api/"
+	defaultBaseUrl = "https://zont-online.ru/api/"
 )
 
 type Client struct {
@@ -23,6 +25,14 @@ type Client struct {
 	xZontClient       string
 	login             string
 	password          string
+	limiter           *rateLimiter
+	validation        ValidationMode
+	devices           *deviceCache
+	writes            *writeLog
+	audit             AuditSink
+	dryRun            bool
+	baseUrl           string
+	tempSteps         *tempSteps
 }
 
 type AuthTokenResponse struct {
@@ -118,10 +128,8 @@ type Device struct {
 			Sources []struct {
 				Class  string `json:"class"`
 				Params struct {
-					ZoneNo int `json:"zone_no"`
-				} `json:"params,omitempty"`
-				Params0 struct {
-					ThermID string `json:"therm_id"`
+					ZoneNo  int    `json:"zone_no,omitempty"`
+					ThermID string `json:"therm_id,omitempty"`
 				} `json:"params,omitempty"`
 			} `json:"sources"`
 			Height       interface{} `json:"height"`
@@ -172,15 +180,15 @@ type Device struct {
 	ThermostatMode    string `json:"thermostat_mode,omitempty"`
 	ThermostatGate    bool   `json:"thermostat_gate,omitempty"`
 	Tempschedule      struct {
-		Day  []float64 `json:"day"`
+		Day  []Celsius `json:"day"`
 		Week struct {
-			Num0 []float64 `json:"0"`
-			Num1 []float64 `json:"1"`
-			Num2 []float64 `json:"2"`
-			Num3 []float64 `json:"3"`
-			Num4 []float64 `json:"4"`
-			Num5 []float64 `json:"5"`
-			Num6 []float64 `json:"6"`
+			Num0 []Celsius `json:"0"`
+			Num1 []Celsius `json:"1"`
+			Num2 []Celsius `json:"2"`
+			Num3 []Celsius `json:"3"`
+			Num4 []Celsius `json:"4"`
+			Num5 []Celsius `json:"5"`
+			Num6 []Celsius `json:"6"`
 		} `json:"week"`
 	} `json:"tempschedule,omitempty"`
 	Tempstep      int `json:"tempstep,omitempty"`
@@ -222,7 +230,7 @@ type Device struct {
 			Success   string `json:"success"`
 		} `json:"autoignition"`
 	} `json:"notifications,omitempty"`
-	ThermostatHysteresis  float64 `json:"thermostat_hysteresis,omitempty"`
+	ThermostatHysteresis  Celsius `json:"thermostat_hysteresis,omitempty"`
 	ThermostatTempsLimits struct {
 		Num0 struct {
 			Max interface{} `json:"max"`
@@ -234,8 +242,8 @@ type Device struct {
 		} `json:"1"`
 	} `json:"thermostat_temps_limits,omitempty"`
 	TemperatureAlarm struct {
-		High int `json:"high"`
-		Low  int `json:"low"`
+		High Celsius `json:"high"`
+		Low  Celsius `json:"low"`
 	} `json:"temperature_alarm,omitempty"`
 	SimInDevice struct {
 		SimType string `json:"sim_type"`
@@ -256,11 +264,11 @@ type Device struct {
 	Iccid            interface{} `json:"iccid,omitempty"`
 	OtEnabled        bool        `json:"ot_enabled,omitempty"`
 	OtSaveParams     []string    `json:"ot_save_params,omitempty"`
-	OtMinSetpoint    float64     `json:"ot_min_setpoint,omitempty"`
-	OtMaxSetpoint    float64     `json:"ot_max_setpoint,omitempty"`
-	OtMaxMl          float64     `json:"ot_max_ml,omitempty"`
-	OtDhwSetpoint    float64     `json:"ot_dhw_setpoint,omitempty"`
-	OtMinWp          float64     `json:"ot_min_wp,omitempty"`
+	OtMinSetpoint    Celsius     `json:"ot_min_setpoint,omitempty"`
+	OtMaxSetpoint    Celsius     `json:"ot_max_setpoint,omitempty"`
+	OtMaxMl          Percent     `json:"ot_max_ml,omitempty"`
+	OtDhwSetpoint    Celsius     `json:"ot_dhw_setpoint,omitempty"`
+	OtMinWp          Bar         `json:"ot_min_wp,omitempty"`
 	OtConfig         []string    `json:"ot_config,omitempty"`
 	OtMode           string      `json:"ot_mode,omitempty"`
 	OtBoilerType     string      `json:"ot_boiler_type,omitempty"`
@@ -286,7 +294,7 @@ type Device struct {
 				Num1 interface{} `json:"1"`
 			} `json:"zone_sensors"`
 			ZoneTemp struct {
-				Num1 float64 `json:"1"`
+				Num1 Celsius `json:"1"`
 			} `json:"zone_temp"`
 		} `json:"0"`
 		Num1 struct {
@@ -297,7 +305,7 @@ type Device struct {
 				Num1 interface{} `json:"1"`
 			} `json:"zone_sensors"`
 			ZoneTemp struct {
-				Num1 float64 `json:"1"`
+				Num1 Celsius `json:"1"`
 			} `json:"zone_temp"`
 		} `json:"1"`
 		Num2 struct {
@@ -317,14 +325,14 @@ type Device struct {
 				Num1 interface{} `json:"1"`
 			} `json:"zone_sensors"`
 			ZoneTemp struct {
-				Num1 float64 `json:"1"`
+				Num1 Celsius `json:"1"`
 			} `json:"zone_temp"`
 		} `json:"3"`
 		Num4 struct {
 			Active   bool   `json:"active"`
 			Name     string `json:"name"`
 			ZoneTemp struct {
-				Num1 float64 `json:"1"`
+				Num1 Celsius `json:"1"`
 			} `json:"zone_temp"`
 			ScheduleNumber interface{} `json:"schedule_number"`
 			ZoneSensors    struct {
@@ -357,54 +365,55 @@ type Device struct {
 	ThermostatRelayMode        string                            `json:"thermostat_relay_mode,omitempty"`
 	OtGateEnabled              bool                              `json:"ot_gate_enabled,omitempty"`
 	UseInternetWeatherForPza   bool                              `json:"use_internet_weather_for_pza,omitempty"`
-	Thermometers               []struct {
-		IsAssignedToSlot bool   `json:"is_assigned_to_slot"`
-		Slot             int    `json:"slot"`
-		UUID             string `json:"uuid"`
-		Serial           string `json:"serial"`
-		Type             string `json:"type"`
-		Name             string `json:"name"`
-		Color            string `json:"color"`
-		Limits           struct {
-			Low  int `json:"low"`
-			High int `json:"high"`
-		} `json:"limits"`
-		Function  string `json:"function"`
-		Functions []struct {
-			F    string `json:"f"`
-			Zone int    `json:"zone"`
-		} `json:"functions"`
-		Sort          int     `json:"sort"`
-		LastState     string  `json:"last_state"`
-		LastValue     float64 `json:"last_value"`
-		LastValueTime int     `json:"last_value_time"`
-	} `json:"thermometers,omitempty"`
-	Filetransfers   []interface{} `json:"filetransfers,omitempty"`
-	InternetWeather float64       `json:"internet_weather,omitempty"`
-	AspBilling      struct {
+	Thermometers               []Thermometer                     `json:"thermometers,omitempty"`
+	Filetransfers              []interface{}                     `json:"filetransfers,omitempty"`
+	InternetWeather            Celsius                           `json:"internet_weather,omitempty"`
+	AspBilling                 struct {
 		InService      bool `json:"in_service"`
 		AllowedForUser bool `json:"allowed_for_user"`
 	} `json:"asp_billing,omitempty"`
+	// raw is JSON of device, see RawJSON
+	raw json.RawMessage
+	// tempStep is step set by Client.SetTempStep
+	tempStep Celsius
+}
+
+type Thermometer struct {
+	IsAssignedToSlot bool   `json:"is_assigned_to_slot"`
+	Slot             int    `json:"slot"`
+	UUID             string `json:"uuid"`
+	Serial           string `json:"serial"`
+	Type             string `json:"type"`
+	Name             string `json:"name"`
+	Color            string `json:"color"`
+	Limits           struct {
+		Low  Celsius `json:"low"`
+		High Celsius `json:"high"`
+	} `json:"limits"`
+	Function  string `json:"function"`
+	Functions []struct {
+		F    string `json:"f"`
+		Zone int    `json:"zone"`
+	} `json:"functions"`
+	Sort          int     `json:"sort"`
+	LastState     string  `json:"last_state"`
+	LastValue     Celsius `json:"last_value"`
+	LastValueTime int     `json:"last_value_time"`
 }
 
 type ThermostatTargetTemps struct {
 	Manual bool    `json:"manual"`
-	Temp   float64 `json:"temp"`
+	Temp   Celsius `json:"temp"`
 }
 
 type LoadDataResponse struct {
 	Ok        bool `json:"ok,omitempty"`
 	Responses []struct {
-		DeviceID      int  `json:"device_id,omitempty"`
-		Ok            bool `json:"ok,omitempty"`
-		TimeTruncated bool `json:"time_truncated,omitempty"`
-		Temperature   map[string]struct {
-			Name        string      `json:"name,omitempty"`
-			Color       string      `json:"color,omitempty"`
-			Sort        int         `json:"sort,omitempty"`
-			Temperature [][]float64 `json:"temperature,omitempty"`
-		} `json:"temperature,omitempty"`
-		Timings struct {
+		DeviceID      int                        `json:"device_id,omitempty"`
+		Ok            bool                       `json:"ok,omitempty"`
+		TimeTruncated bool                       `json:"time_truncated,omitempty"`
+		Temperature   map[string]TemperatureData `json:"temperature,omitempty"`
+		Timings       struct {
 			Temperature struct {
 				Wall float64 `json:"wall,omitempty"`
 				Proc float64 `json:"proc,omitempty"`
@@ -413,38 +422,48 @@ type LoadDataResponse struct {
 	} `json:"responses,omitempty"`
 }
 
+type TemperatureData struct {
+	Name        string      `json:"name,omitempty"`
+	Color       string      `json:"color,omitempty"`
+	Sort        int         `json:"sort,omitempty"`
+	Temperature [][]float64 `json:"temperature,omitempty"`
+}
+
+// https://zont-online.ru/api/docs/#thermostat_work
+type ThermostatWork struct {
+	ThermostatMode [][]int     `json:"thermostat_mode"`
+	DhwT           [][]float64 `json:"dhw_t"`
+	Power          [][]any     `json:"power"`
+	Fail           [][]any     `json:"fail"`
+	Gate           [][]any     `json:"gate"`
+	Ot             struct {
+		Cs  [][]int     `json:"cs"`
+		Bt  [][]int     `json:"bt"`
+		Dt  [][]int     `json:"dt"`
+		Rwt [][]int     `json:"rwt"`
+		Rml [][]int     `json:"rml"`
+		Wp  [][]float64 `json:"wp"`
+		S   [][]any     `json:"s"`
+	} `json:"ot"`
+	Zones struct {
+		Num1 struct {
+			TargetTemp [][]int `json:"target_temp"`
+			Worktime   [][]int `json:"worktime"`
+		} `json:"1"`
+	} `json:"zones"`
+	BoilerWorkTime [][]int `json:"boiler_work_time"`
+	TargetTemp     [][]int `json:"target_temp"`
+}
+
 // https://zont-online.ru/api/docs/#thermostat_work
 type LoadDataThermostatWorkResponse struct {
 	Ok        bool `json:"ok"`
 	Responses []struct {
-		DeviceID       int  `json:"device_id"`
-		Ok             bool `json:"ok"`
-		TimeTruncated  bool `json:"time_truncated"`
-		ThermostatWork struct {
-			ThermostatMode [][]int     `json:"thermostat_mode"`
-			DhwT           [][]float64 `json:"dhw_t"`
-			Power          [][]any     `json:"power"`
-			Fail           [][]any     `json:"fail"`
-			Gate           [][]any     `json:"gate"`
-			Ot             struct {
-				Cs  [][]int     `json:"cs"`
-				Bt  [][]int     `json:"bt"`
-				Dt  [][]int     `json:"dt"`
-				Rwt [][]int     `json:"rwt"`
-				Rml [][]int     `json:"rml"`
-				Wp  [][]float64 `json:"wp"`
-				S   [][]any     `json:"s"`
-			} `json:"ot"`
-			Zones struct {
-				Num1 struct {
-					TargetTemp [][]int `json:"target_temp"`
-					Worktime   [][]int `json:"worktime"`
-				} `json:"1"`
-			} `json:"zones"`
-			BoilerWorkTime [][]int `json:"boiler_work_time"`
-			TargetTemp     [][]int `json:"target_temp"`
-		} `json:"thermostat_work"`
-		Timings struct {
+		DeviceID       int            `json:"device_id"`
+		Ok             bool           `json:"ok"`
+		TimeTruncated  bool           `json:"time_truncated"`
+		ThermostatWork ThermostatWork `json:"thermostat_work"`
+		Timings        struct {
 			ThermostatWork struct {
 				Wall float64 `json:"wall"`
 				Proc float64 `json:"proc"`
@@ -455,8 +474,12 @@ type LoadDataThermostatWorkResponse struct {
 
 // NewClient return new client
 func NewClient(clientName, xZontClient, login, password string) *Client {
+	limiter := newRateLimiter()
+
 	retryClient := retryablehttp.NewClient()
 	retryClient.RetryMax = 10
+	retryClient.Backoff = retryAfterBackoff
+	retryClient.HTTPClient.Transport = &limitedTransport{retryClient.HTTPClient.Transport, limiter}
 
 	standardClient := retryClient.StandardClient() // *http.Client
 
@@ -471,9 +494,22 @@ func NewClient(clientName, xZontClient, login, password string) *Client {
 		xZontClient,
 		login,
 		password,
+		limiter,
+		ValidateStrict,
+		&deviceCache{ttl: defaultDeviceCacheTTL},
+		&writeLog{},
+		nil,
+		false,
+		defaultBaseUrl,
+		&tempSteps{},
 	}
 }
 
+// SetBaseURL set ZONT API url, for example of test server, url must end with slash
+func (cl *Client) SetBaseURL(url string) {
+	cl.baseUrl = url
+}
+
 // PostRequestHandler handle all post requests
 func (cl *Client) PostRequestHandler(data interface{}, uri string, basic bool) []byte {
 	jsonValue, err := json.Marshal(data)
@@ -493,9 +529,11 @@ func (cl *Client) PostRequestHandler(data interface{}, uri string, basic bool) [
 	} else {
 		req.Header.Set("X-ZONT-Token", cl.AuthTokenResponse.Token)
 	}
+	cl.limiter.call()
 	res, err := cl.httpClient.Do(req)
 	if err != nil {
 		ContextLogger.Error(err)
+		return nil
 	}
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -510,7 +548,7 @@ func (cl *Client) PostRequestHandler(data interface{}, uri string, basic bool) [
 // GetAuthToken return token base on login and password
 func (cl *Client) GetAuthToken() {
 	method := "get_authtoken"
-	uri := baseUrl + method
+	uri := cl.baseUrl + method
 	values := map[string]string{"client_name": cl.clientName}
 
 	body := cl.PostRequestHandler(values, uri, true)
@@ -529,7 +567,7 @@ func (cl *Client) GetDevices() *DevicesResponse {
 	}
 
 	method := "devices"
-	uri := baseUrl + method
+	uri := cl.baseUrl + method
 	values := map[string]string{"client_name": cl.clientName}
 
 	body := cl.PostRequestHandler(values, uri, false)
@@ -540,31 +578,71 @@ func (cl *Client) GetDevices() *DevicesResponse {
 	if err != nil {
 		ContextLogger.Error(err)
 	}
+	for i := range devices.Devices {
+		cl.tempSteps.apply(&devices.Devices[i])
+	}
 
 	return &devices
 }
 
-// UpdateDevice send update request based on data interface
-func (cl *Client) UpdateDevice(data interface{}) error {
-	if len(cl.AuthTokenResponse.Token) < 1 {
+// ErrConfirmUnsupported is returned by UpdateDevice and ApplyPatch with WithConfirm,
+// they can not tell how to check arbitrary payload
+var ErrConfirmUnsupported = errors.New("WithConfirm is supported only by write helpers")
+
+// UpdateDevice send update request based on data interface, WithConfirm is rejected
+func (cl *Client) UpdateDevice(data interface{}, opts ...WriteOption) error {
+	options := cl.writeOptions(opts)
+	if options.confirmTimeout > 0 {
+		ContextLogger.Error(ErrConfirmUnsupported)
+		return ErrConfirmUnsupported
+	}
+	return cl.updateDevice("update_device", options, data)
+}
+
+// updateDevice send update request and record it in audit as operation
+func (cl *Client) updateDevice(operation string, options *writeOptions, data interface{}) error {
+	if options.correlationID == "" {
+		options.correlationID = newCommandID()
+	}
+	if cl.audit != nil && options.diff == nil {
+		// device state before write
+		options.diff = cl.payloadDiff(data)
+	}
+	if options.dryRun {
+		return cl.dryRunWrite(operation, options, data)
+	}
+
+	if cl.AuthTokenResponse == nil || len(cl.AuthTokenResponse.Token) < 1 {
 		ContextLogger.Infoln("AuthToken not exist!")
-		return nil
+		err := errors.New("AuthToken not exist")
+		// failed write is returned, audit error is only logged then
+		cl.auditWrite(operation, options, data, err)
+		return err
 	}
 
 	method := "update_device"
-	uri := baseUrl + method
+	uri := cl.baseUrl + method
 
+	cl.writes.record(data)
 	body := cl.PostRequestHandler(data, uri, false)
 
-	devices := DevicesResponse{}
+	resp := struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}{}
 
-	err := json.Unmarshal(body, &devices)
+	err := json.Unmarshal(body, &resp)
+	if err == nil && !resp.Ok {
+		err = fmt.Errorf("%w: %s", ErrWriteRejected, resp.Error)
+	}
+	auditErr := cl.auditWrite(operation, options, data, err)
 	if err != nil {
 		ContextLogger.Error(err)
 		return err
 	}
+	cl.writeResult(operation, options, data)
 
-	return nil
+	return auditErr
 }
 
 // LoadData return device information and metrics based on data interface
@@ -575,7 +653,7 @@ func (cl *Client) LoadData(data interface{}) *LoadDataResponse {
 	}
 
 	method := "load_data"
-	uri := baseUrl + method
+	uri := cl.baseUrl + method
 
 	body := cl.PostRequestHandler(data, uri, false)
 
@@ -597,7 +675,7 @@ func (cl *Client) LoadDataThermostatWork(data interface{}) *LoadDataThermostatWo
 	}
 
 	method := "load_data"
-	uri := baseUrl + method
+	uri := cl.baseUrl + method
 
 	body := cl.PostRequestHandler(data, uri, false)
 
@@ -673,25 +751,130 @@ func (cl *Client) GetCurrentHotWaterTemp(deviceId int) (temp float64) {
 	return loadResp.Responses[0].ThermostatWork.DhwT[0][1]
 }
 
+type DataRequest struct {
+	DeviceID  int      `json:"device_id"`
+	DataTypes []string `json:"data_types"`
+	MinTime   int64    `json:"mintime"`
+	MaxTime   int64    `json:"maxtime"`
+}
+
+type LoadDataRequest struct {
+	Requests []DataRequest `json:"requests"`
+}
+
+// GetBoilerFail return last boiler fail state from thermostat_work on device with deviceId
+func (cl *Client) GetBoilerFail(deviceId int) (fail bool) {
+	dataLoad := LoadDataRequest{}
+	dataLoad.Requests = append(dataLoad.Requests, DataRequest{
+		DeviceID:  deviceId,
+		DataTypes: []string{"thermostat_work"},
+		MaxTime:   time.Now().Unix(),
+		MinTime:   time.Now().Add(-180 * time.Second).Unix(),
+	})
+
+	loadResp := cl.LoadDataThermostatWork(dataLoad)
+	if loadResp == nil || len(loadResp.Responses) < 1 {
+		return fail
+	}
+	last, ok := DecodeSeries(loadResp.Responses[0].ThermostatWork.Fail).Last()
+	if !ok {
+		return fail
+	}
+	return last.Value != 0
+}
+
 type ThermostatData struct {
 	DeviceID              int                              `json:"device_id"`
 	ThermostatTargetTemps map[string]ThermostatTargetTemps `json:"thermostat_target_temps"`
 }
 
-// SetTargetTemp send temperature update request based on deviceId and targetTemp
-func (cl *Client) SetTargetTemp(deviceId int, termostatid string, targetTemp float64) error {
+// SetTargetTemp send temperature update request based on deviceId and targetTemp.
+// targetTemp is checked against device limits before sending when validation is
+// enabled, see SetValidation and WithCoolantZone.
+func (cl *Client) SetTargetTemp(deviceId int, termostatid string, targetTemp float64, opts ...WriteOption) error {
+	options := cl.writeOptions(opts)
+
+	temp := NewCelsius(targetTemp)
+	if options.validation != ValidateOff {
+		device, err := cl.Device(deviceId)
+		if err != nil {
+			ContextLogger.Error(err)
+			return err
+		}
+		if options.coolant {
+			temp, err = device.ValidateCoolantSetpoint(termostatid, temp, options.validation)
+		} else {
+			temp, err = device.ValidateSetpoint(termostatid, temp, options.validation)
+		}
+		if err != nil {
+			ContextLogger.Error(err)
+			return err
+		}
+	}
+
 	// Update data
 	data := ThermostatData{}
 	data.DeviceID = deviceId
 	data.ThermostatTargetTemps = map[string]ThermostatTargetTemps{
-		termostatid: {Manual: true, Temp: targetTemp},
+		termostatid: {Manual: true, Temp: temp},
+	}
+
+	written := time.Now()
+	err := cl.updateDevice("set_target_temp", options, data)
+	if err != nil {
+		ContextLogger.Error(err)
+		return err
+	}
+
+	return cl.confirm(deviceId, written, options, cl.zoneTargetApplied(termostatid, temp, written))
+}
+
+type ExtModeData struct {
+	DeviceID          int `json:"device_id"`
+	ThermostatExtMode int `json:"thermostat_ext_mode"`
+}
+
+// SetExtMode send extended mode switch request based on deviceId and mode number from ThermostatExtModesConfig
+func (cl *Client) SetExtMode(deviceId int, mode int, opts ...WriteOption) error {
+	options := cl.writeOptions(opts)
+
+	data := ExtModeData{}
+	data.DeviceID = deviceId
+	data.ThermostatExtMode = mode
+
+	written := time.Now()
+	err := cl.updateDevice("set_ext_mode", options, data)
+	if err != nil {
+		ContextLogger.Error(err)
+		return err
 	}
 
-	err := cl.UpdateDevice(data)
+	return cl.confirm(deviceId, written, options, func(d *Device) bool {
+		return d.ThermostatExtMode == mode
+	})
+}
+
+type GuardData struct {
+	DeviceID              int  `json:"device_id"`
+	ThermostatEnableGuard bool `json:"thermostat_enable_guard"`
+}
+
+// SetGuard send guard arm (enable true) or disarm (enable false) request based on deviceId
+func (cl *Client) SetGuard(deviceId int, enable bool, opts ...WriteOption) error {
+	options := cl.writeOptions(opts)
+
+	data := GuardData{}
+	data.DeviceID = deviceId
+	data.ThermostatEnableGuard = enable
+
+	written := time.Now()
+	err := cl.updateDevice("set_guard", options, data)
 	if err != nil {
 		ContextLogger.Error(err)
 		return err
 	}
 
-	return nil
+	return cl.confirm(deviceId, written, options, func(d *Device) bool {
+		return d.ThermostatEnableGuard == enable
+	})
 }
@@ -0,0 +1,52 @@
+package zont
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// rewriteTransport send requests for api host to test server
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestClient return authorized client sending api requests to handler
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := NewClient("test", "test", "login", "password")
+	cl.httpClient = &http.Client{Transport: rewriteTransport{target}}
+	cl.AuthTokenResponse = &AuthTokenResponse{Token: "token", Ok: true}
+	cl.SetRateLimit(0, 0)
+	return cl
+}
+
+func TestUpdateDeviceRejected(t *testing.T) {
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"access_denied"}`))
+	}))
+
+	err := cl.UpdateDevice(map[string]interface{}{"device_id": 7})
+	if !errors.Is(err, ErrWriteRejected) {
+		t.Fatalf("got %v, want %v", err, ErrWriteRejected)
+	}
+	if WriteStatusOf(err) != WriteFailed {
+		t.Errorf("status %s, want %s", WriteStatusOf(err), WriteFailed)
+	}
+}
@@ -0,0 +1,221 @@
+package zont
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// CloneResult is result of cloning configuration to one device
+type CloneResult struct {
+	DeviceID int
+	Patch    *DevicePatch
+	// Skipped is thermometers of source without matching slot on device and zone
+	// sensors of modes which were cleared because of it
+	Skipped []string
+	Err     error
+}
+
+// thermometerMap return destination thermometer for every source thermometer uuid,
+// thermometers are matched by slot
+func thermometerMap(src, dst *Device) (map[string]*Thermometer, []string) {
+	bySlot := map[int]*Thermometer{}
+	for i := range dst.Thermometers {
+		t := &dst.Thermometers[i]
+		if t.IsAssignedToSlot {
+			bySlot[t.Slot] = t
+		}
+	}
+
+	mapping := map[string]*Thermometer{}
+	var skipped []string
+	for _, t := range src.Thermometers {
+		if d, ok := bySlot[t.Slot]; ok && t.IsAssignedToSlot {
+			mapping[t.UUID] = d
+		} else {
+			skipped = append(skipped, t.Name)
+		}
+	}
+	return mapping, skipped
+}
+
+// thermometerIdentity is fields of thermometer bound to its hardware, they are not cloned
+var thermometerIdentity = []string{"uuid", "serial", "slot", "is_assigned_to_slot"}
+
+// cloneThermometers return thermometers of dst with settings of matched thermometers
+// of src, uuid, serial, slot and state of destination are kept
+func cloneThermometers(src, dst []interface{}, mapping map[string]*Thermometer) []interface{} {
+	settings := map[string]map[string]interface{}{}
+	for _, item := range src {
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		uuid, _ := t["uuid"].(string)
+		if d, ok := mapping[uuid]; ok {
+			settings[d.UUID] = t
+		}
+	}
+
+	cloned := make([]interface{}, len(dst))
+	for i, item := range dst {
+		cloned[i] = item
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		uuid, _ := t["uuid"].(string)
+		values, ok := settings[uuid]
+		if !ok {
+			continue
+		}
+		c := map[string]interface{}{}
+		for key, value := range values {
+			c[key] = value
+		}
+		for _, key := range thermometerIdentity {
+			if value, ok := t[key]; ok {
+				c[key] = value
+			} else {
+				delete(c, key)
+			}
+		}
+		cloned[i] = c
+	}
+	return cloned
+}
+
+// remapZoneSensors replace source thermometers in zone_sensors of extended modes,
+// sensor is uuid or slot number of thermometer. Sensors without matching thermometer
+// on destination are cleared and returned.
+func remapZoneSensors(section map[string]interface{}, src *Device, mapping map[string]*Thermometer) []string {
+	modes, ok := section["thermostat_ext_modes_config"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	slots := map[int]*Thermometer{}
+	for _, t := range src.Thermometers {
+		if d, ok := mapping[t.UUID]; ok {
+			slots[t.Slot] = d
+		}
+	}
+
+	var unmapped []string
+	for number, mode := range modes {
+		m, ok := mode.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sensors, ok := m["zone_sensors"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for zone, sensor := range sensors {
+			switch value := sensor.(type) {
+			case string:
+				if t, ok := mapping[value]; ok {
+					sensors[zone] = t.UUID
+					continue
+				}
+			case float64:
+				if t, ok := slots[int(value)]; ok {
+					sensors[zone] = float64(t.Slot)
+					continue
+				}
+			default:
+				continue
+			}
+			sensors[zone] = nil
+			unmapped = append(unmapped, fmt.Sprintf("mode %s zone %s sensor %v", number, zone, sensor))
+		}
+	}
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// copySection return deep copy of snapshot section
+func copySection(section map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(section)
+	if err != nil {
+		return nil, err
+	}
+	c := map[string]interface{}{}
+	return c, json.Unmarshal(data, &c)
+}
+
+// ClonePatch return patch which copy sections of src to dst, thermometers are
+// matched by slot keeping uuid and serial of dst. Skipped is source thermometers
+// and zone sensors without matching thermometer on dst.
+func ClonePatch(src, dst *Device, sections ...string) (p *DevicePatch, skipped []string, err error) {
+	snapshot := Snapshot(src)
+	if len(sections) == 0 {
+		sections = snapshot.SectionNames()
+	}
+
+	p = NewDevicePatch(dst)
+	mapping, skipped := thermometerMap(src, dst)
+
+	for _, section := range sections {
+		values, ok := snapshot.Sections[section]
+		if !ok {
+			return nil, nil, fmt.Errorf("source device %d has no section %q", src.ID, section)
+		}
+		values, err := copySection(values)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch section {
+		case SectionThermometers:
+			list, _ := values["thermometers"].([]interface{})
+			current, ok := p.base["thermometers"].([]interface{})
+			if !ok {
+				continue
+			}
+			values["thermometers"] = cloneThermometers(list, current, mapping)
+		case SectionModes:
+			skipped = append(skipped, remapZoneSensors(values, src, mapping)...)
+		}
+		for key, value := range values {
+			p.Set(key, value)
+		}
+	}
+	return p, skipped, nil
+}
+
+// ClonePatches return patches copying sections of device src to every device of dst
+// without sending them, use it to preview CloneConfig
+func (cl *Client) ClonePatches(src int, dst []int, sections ...string) ([]CloneResult, error) {
+	cl.InvalidateDevices()
+	source, err := cl.Device(src)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CloneResult, 0, len(dst))
+	for _, id := range dst {
+		r := CloneResult{DeviceID: id}
+		target, err := cl.Device(id)
+		if err != nil {
+			r.Err = err
+		} else {
+			r.Patch, r.Skipped, r.Err = ClonePatch(source, target, sections...)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// CloneConfig copy sections of device src, for example SectionSchedule or SectionPZA,
+// to every device of dst. All sections are copied when none is given.
+func (cl *Client) CloneConfig(src int, dst []int, sections ...string) ([]CloneResult, error) {
+	results, err := cl.ClonePatches(src, dst, sections...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = cl.ApplyPatch(results[i].Patch)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,72 @@
+package zont
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClonePatch(t *testing.T) {
+	src := testDevice(t, `{"id":7,
+		"thermometers":[
+			{"uuid":"s1","serial":"28AA","slot":1,"is_assigned_to_slot":true,"name":"Hall","offset":-0.5,"last_value":20},
+			{"uuid":"s2","serial":"28BB","slot":2,"is_assigned_to_slot":true,"name":"Attic"}],
+		"thermostat_ext_modes_config":{
+			"1":{"active":true,"name":"Comfort","zone_sensors":{"1":"s1","2":"s2"}},
+			"4":{"active":true,"name":"Away","zone_sensors":{"1":1,"2":2}}},
+		"tempschedule":{"day":[18,21]}}`)
+	dst := testDevice(t, `{"id":8,
+		"thermometers":[{"uuid":"d1","serial":"28CC","slot":1,"is_assigned_to_slot":true,"name":"T1","last_value":19}],
+		"thermostat_ext_modes_config":{"1":{"active":true,"name":"Day"}}}`)
+
+	p, skipped, err := ClonePatch(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Attic,mode 1 zone 2 sensor s2,mode 4 zone 2 sensor 2"
+	if strings.Join(skipped, ",") != want {
+		t.Errorf("skipped = %v, want %s", skipped, want)
+	}
+
+	payload := p.Payload()
+	thermometers := payload["thermometers"].([]interface{})
+	if len(thermometers) != 1 {
+		t.Fatalf("thermometers = %v", thermometers)
+	}
+	thermometer := thermometers[0].(map[string]interface{})
+	if thermometer["uuid"] != "d1" || thermometer["serial"] != "28CC" || thermometer["name"] != "Hall" ||
+		thermometer["offset"] != -0.5 || thermometer["last_value"] != 19.0 {
+		t.Errorf("thermometer = %v", thermometer)
+	}
+
+	modes := payload["thermostat_ext_modes_config"].(map[string]interface{})
+	comfort := modes["1"].(map[string]interface{})["zone_sensors"].(map[string]interface{})
+	if comfort["1"] != "d1" || comfort["2"] != nil {
+		t.Errorf("comfort zone sensors = %v", comfort)
+	}
+	away := modes["4"].(map[string]interface{})["zone_sensors"].(map[string]interface{})
+	if away["1"] != 1.0 || away["2"] != nil {
+		t.Errorf("away zone sensors = %v", away)
+	}
+	if p.Device.ID != 8 || payload["device_id"] != 8 {
+		t.Errorf("patch of device %d", p.Device.ID)
+	}
+	if src.ThermostatExtModesConfig.Num1.ZoneSensors.Num1 != "s1" {
+		t.Error("source device is changed")
+	}
+}
+
+func TestClonePatchSection(t *testing.T) {
+	src := testDevice(t, `{"id":7,"tempschedule":{"day":[18,21]},"pza":{"enabled":true,"curve":12}}`)
+	dst := testDevice(t, `{"id":8,"tempschedule":{"day":[16,16]},"pza":{"enabled":false,"curve":4}}`)
+	p, _, err := ClonePatch(src, dst, SectionSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := p.Payload()
+	if _, ok := payload["pza"]; ok || len(payload) != 2 {
+		t.Errorf("payload = %v, want only tempschedule", payload)
+	}
+	if _, _, err := ClonePatch(src, dst, SectionBoilerDelay); err == nil {
+		t.Error("missing section is not reported")
+	}
+}
@@ -0,0 +1,37 @@
+// zont-hass run MQTT bridge between ZONT account and Home Assistant.
+//
+// Settings are read from environment: ZONT_LOGIN, ZONT_PASSWORD, ZONT_CLIENT,
+// MQTT_BROKER, MQTT_USERNAME, MQTT_PASSWORD.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dematron/go-zont"
+	"github.com/dematron/go-zont/hass"
+)
+
+func main() {
+	interval := flag.Duration("interval", 0, "ZONT poll interval")
+	flag.Parse()
+
+	client := zont.NewClient("go-zont-hass", os.Getenv("ZONT_CLIENT"), os.Getenv("ZONT_LOGIN"), os.Getenv("ZONT_PASSWORD"))
+
+	bridge := hass.NewBridge(client, hass.Config{
+		Broker:   os.Getenv("MQTT_BROKER"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+		Interval: *interval,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := bridge.Run(ctx); err != nil {
+		zont.ContextLogger.Fatal(err)
+	}
+}
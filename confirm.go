@@ -0,0 +1,184 @@
+package zont
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type WriteStatus string
+
+const (
+	// WriteSent means server accepted change, it was not confirmed with controller
+	WriteSent WriteStatus = "sent"
+	// WriteApplied means controller reported new value
+	WriteApplied WriteStatus = "applied"
+	// WritePending means server accepted change but controller did not report since
+	WritePending WriteStatus = "pending"
+	// WriteFailed means change was rejected or controller reported other value
+	WriteFailed WriteStatus = "failed"
+)
+
+const defaultConfirmInterval = 15 * time.Second
+
+var (
+	// ErrWritePending is returned by confirmed write when controller did not report in time
+	ErrWritePending = errors.New("change accepted by server but not yet applied by controller")
+	// ErrWriteNotApplied is returned by confirmed write when controller reported other value
+	ErrWriteNotApplied = errors.New("controller reported value different from written")
+	// ErrWriteRejected is returned by write when server answered update_device with ok false
+	ErrWriteRejected = errors.New("change rejected by server")
+)
+
+// WriteStatusOf return status of write helper error. Nil error is WriteSent, it
+// does not tell whether write was confirmed, Status of WithResult does.
+func WriteStatusOf(err error) WriteStatus {
+	switch {
+	case err == nil:
+		return WriteSent
+	case errors.Is(err, ErrAuditFailed):
+		// write is sent, only its record failed
+		return WriteSent
+	case errors.Is(err, ErrWritePending):
+		return WritePending
+	}
+	return WriteFailed
+}
+
+// WithConfirm make write helper wait up to timeout until controller reflect new
+// value. Result is nil when applied, ErrWritePending when controller did not report
+// in time and ErrWriteNotApplied when it reported other value. Status of WithResult
+// is WriteApplied, WritePending or WriteFailed then. UpdateDevice and ApplyPatch
+// can not tell how to check arbitrary payload and reject it.
+func WithConfirm(timeout time.Duration) WriteOption {
+	return func(o *writeOptions) {
+		o.confirmTimeout = timeout
+		if o.confirmInterval <= 0 {
+			o.confirmInterval = defaultConfirmInterval
+		}
+	}
+}
+
+// WithConfirmInterval set poll interval of WithConfirm, 15 seconds by default
+func WithConfirmInterval(interval time.Duration) WriteOption {
+	return func(o *writeOptions) {
+		o.confirmInterval = interval
+	}
+}
+
+// WithContext stop waiting of WithConfirm when ctx is done, write returns
+// ErrWritePending wrapping ctx error then
+func WithContext(ctx context.Context) WriteOption {
+	return func(o *writeOptions) {
+		o.ctx = ctx
+	}
+}
+
+// confirmCheck return true when value is applied by device
+type confirmCheck func(d *Device) bool
+
+// confirm poll device until controller report after written and check pass,
+// status of WithResult is set from result
+func (cl *Client) confirm(deviceId int, written time.Time, options *writeOptions, check confirmCheck) error {
+	// nothing was sent in dry run
+	if options.confirmTimeout <= 0 || options.dryRun {
+		return nil
+	}
+	err := cl.waitApplied(deviceId, written, options, check)
+	if options.result != nil {
+		options.result.Status = WriteStatusOf(err)
+		if err == nil {
+			options.result.Status = WriteApplied
+		}
+	}
+	return err
+}
+
+// waitApplied poll device every interval until deadline, device is checked
+// once more at deadline
+func (cl *Client) waitApplied(deviceId int, written time.Time, options *writeOptions, check confirmCheck) error {
+	interval := options.confirmInterval
+	if interval <= 0 {
+		interval = defaultConfirmInterval
+	}
+
+	ctx := options.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	deadline := written.Add(options.confirmTimeout)
+	reported := false
+	for {
+		cl.InvalidateDevices()
+		d, err := cl.Device(deviceId)
+		if err != nil {
+			ContextLogger.Error(err)
+		} else if err := checkApplied(d, written, check); err == nil {
+			return nil
+		} else if errors.Is(err, ErrWriteNotApplied) {
+			reported = true
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		timer := time.NewTimer(min(interval, remaining))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// write is sent, only waiting for controller is cancelled
+			return fmt.Errorf("%w: %w", ErrWritePending, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	if reported {
+		return ErrWriteNotApplied
+	}
+	return ErrWritePending
+}
+
+// checkApplied check once whether controller reported after written and check
+// pass. Result is nil, ErrWriteNotApplied or ErrWritePending when controller did
+// not report yet.
+func checkApplied(d *Device, written time.Time, check confirmCheck) error {
+	if d.LastReceiveTime <= 0 || !d.LastReceive().After(written) {
+		return ErrWritePending
+	}
+	if check(d) {
+		return nil
+	}
+	return ErrWriteNotApplied
+}
+
+// zoneTargetApplied check target temperature reported by controller in thermostat_work,
+// settings of device are used when controller does not send zone target
+func (cl *Client) zoneTargetApplied(zone string, temp Celsius, written time.Time) confirmCheck {
+	return func(d *Device) bool {
+		dataLoad := LoadDataRequest{}
+		dataLoad.Requests = append(dataLoad.Requests, DataRequest{
+			DeviceID:  d.ID,
+			DataTypes: []string{"thermostat_work"},
+			MinTime:   written.Unix(),
+			MaxTime:   time.Now().Unix(),
+		})
+		responses, err := cl.LoadDataRaw(dataLoad)
+		if err == nil {
+			if resp, ok := responses[d.ID]; ok {
+				key := "thermostat_work/zones/" + zone + "/target_temp"
+				if last, ok := resp.History().Series[key].Last(); ok && last.Time >= written.Unix() {
+					return last.Celsius() == temp
+				}
+			}
+		}
+
+		if d.ThermostatTargetTemps == nil {
+			return false
+		}
+		target, ok := (*d.ThermostatTargetTemps)[zone]
+		return ok && target.Temp == temp
+	}
+}
@@ -0,0 +1,98 @@
+package zont
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConfirmContextCancel(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[{"id":7,"online":true}]}`, &updates))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := cl.SetExtMode(7, 2, WithConfirm(time.Hour), WithConfirmInterval(time.Minute), WithContext(ctx))
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("confirm was not cancelled, took %s", elapsed)
+	}
+	if !errors.Is(err, ErrWritePending) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want pending and deadline exceeded", err)
+	}
+	if WriteStatusOf(err) != WritePending {
+		t.Errorf("status %s, want %s", WriteStatusOf(err), WritePending)
+	}
+	if updates != 1 {
+		t.Errorf("sent %d update_device requests, want 1", updates)
+	}
+}
+
+func TestConfirmShorterThanInterval(t *testing.T) {
+	var devices atomic.Int32
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			// controller report new mode on second poll
+			mode := 1
+			if devices.Add(1) > 1 {
+				mode = 2
+			}
+			fmt.Fprintf(w, `{"ok":true,"devices":[{"id":7,"thermostat_ext_mode":%d,"last_receive_time":%d}]}`,
+				mode, time.Now().Add(time.Minute).Unix())
+		case strings.HasSuffix(r.URL.Path, "/update_device"):
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+
+	var result WriteResult
+	started := time.Now()
+	err := cl.SetExtMode(7, 2, WithConfirm(200*time.Millisecond), WithResult(&result))
+	if err != nil {
+		t.Fatalf("got %v, want applied", err)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("confirmed after %s, want check at 200ms deadline", elapsed)
+	}
+	if result.Status != WriteApplied || devices.Load() != 2 {
+		t.Errorf("status %s after %d polls, want %s after 2", result.Status, devices.Load(), WriteApplied)
+	}
+
+	devices.Store(-10)
+	err = cl.SetExtMode(7, 2, WithConfirm(50*time.Millisecond), WithResult(&result))
+	if !errors.Is(err, ErrWriteNotApplied) || result.Status != WriteFailed {
+		t.Errorf("got %v status %s, want not applied", err, result.Status)
+	}
+}
+
+func TestWriteStatusWithoutConfirm(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[{"id":7}]}`, &updates))
+
+	var result WriteResult
+	err := cl.SetGuard(7, true, WithResult(&result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if WriteStatusOf(err) != WriteSent || result.Status != WriteSent {
+		t.Errorf("status %s %s, want %s", WriteStatusOf(err), result.Status, WriteSent)
+	}
+
+	payload := map[string]interface{}{"device_id": 7}
+	if err := cl.UpdateDevice(payload, WithConfirm(time.Second)); !errors.Is(err, ErrConfirmUnsupported) {
+		t.Errorf("UpdateDevice with confirm: %v", err)
+	}
+	p := NewDevicePatch(testDevice(t, `{"id":7}`)).Set("pump", 1)
+	if err := cl.ApplyPatch(p, WithConfirm(time.Second)); !errors.Is(err, ErrConfirmUnsupported) {
+		t.Errorf("ApplyPatch with confirm: %v", err)
+	}
+	if updates != 1 {
+		t.Errorf("got %d updates, want 1", updates)
+	}
+}
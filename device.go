@@ -0,0 +1,163 @@
+package zont
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// UnmarshalJSON decode device and keep its JSON, fields which Device does not
+// model are kept there. Decoding into device with JSON replaces its top level fields.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type device Device
+	raw := d.raw
+	if err := json.Unmarshal(data, (*device)(d)); err != nil {
+		return err
+	}
+	if raw == nil {
+		d.raw = append(json.RawMessage(nil), data...)
+		return nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	d.raw = merged
+	return nil
+}
+
+// RawJSON return JSON of device as received from ZONT, nil when device was not decoded from JSON
+func (d *Device) RawJSON() json.RawMessage {
+	return d.raw
+}
+
+// ExtModeNames return names of active extended modes indexed by mode number
+func (d *Device) ExtModeNames() map[int]string {
+	c := d.ThermostatExtModesConfig
+	modes := []struct {
+		active bool
+		name   string
+	}{
+		{c.Num0.Active, c.Num0.Name},
+		{c.Num1.Active, c.Num1.Name},
+		{c.Num2.Active, c.Num2.Name},
+		{c.Num3.Active, c.Num3.Name},
+		{c.Num4.Active, c.Num4.Name},
+		{c.Num5.Active, c.Num5.Name},
+		{c.Num6.Active, c.Num6.Name},
+		{c.Num7.Active, c.Num7.Name},
+		{c.Num8.Active, c.Num8.Name},
+		{c.Num9.Active, c.Num9.Name},
+	}
+
+	names := map[int]string{}
+	for i, m := range modes {
+		if m.active {
+			names[i] = m.name
+		}
+	}
+	return names
+}
+
+// ZoneTemp return last value of first thermometer assigned to zone
+func (d *Device) ZoneTemp(zone string) (temp Celsius, ok bool) {
+	zoneNo, err := strconv.Atoi(zone)
+	if err != nil {
+		return 0, false
+	}
+	for _, t := range d.Thermometers {
+		for _, f := range t.Functions {
+			if f.Zone == zoneNo {
+				return t.LastValue, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Location return fixed time zone of device from Timezone offset in hours
+func (d *Device) Location() *time.Location {
+	offset := d.Timezone * 3600
+	if d.Timezone > 14 || d.Timezone < -14 {
+		// offset in minutes
+		offset = d.Timezone * 60
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%+03d:%02d", offset/3600, abs(offset%3600)/60), offset)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Time return unix time of device data in device time zone
+func (d *Device) Time(unix int64) time.Time {
+	return time.Unix(unix, 0).In(d.Location())
+}
+
+// LastReceive return time of last data from device in device time zone
+func (d *Device) LastReceive() time.Time {
+	return d.Time(int64(d.LastReceiveTime))
+}
+
+// ThermometerTime return time of last thermometer value in device time zone
+func (d *Device) ThermometerTime(t *Thermometer) time.Time {
+	return d.Time(int64(t.LastValueTime))
+}
+
+// SampleTime return time of sample in device time zone
+func (d *Device) SampleTime(s Sample) time.Time {
+	return d.Time(s.Time)
+}
+
+// Day return start and end of device local day containing t
+func (d *Device) Day(t time.Time) (start, end time.Time) {
+	start = dayStart(t.Unix(), d.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Days return starts of device local days from day of from up to to
+func (d *Device) Days(from, to time.Time) []time.Time {
+	var days []time.Time
+	for day, _ := d.Day(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// ScheduleSlot return week day (0 is Monday) and slot of schedule for t in device
+// local time, slots split day evenly
+func (d *Device) ScheduleSlot(t time.Time, slots int) (weekday, slot int) {
+	local := t.In(d.Location())
+	minute := local.Hour()*60 + local.Minute()
+	return (int(local.Weekday()) + 6) % 7, minute * slots / (24 * 60)
+}
+
+// ScheduleAt return scheduled temperature at t in device local time. Week schedule
+// of weekday is used when set, day schedule otherwise.
+func (d *Device) ScheduleAt(t time.Time) (temp Celsius, ok bool) {
+	w := d.Tempschedule.Week
+	week := [7][]Celsius{w.Num0, w.Num1, w.Num2, w.Num3, w.Num4, w.Num5, w.Num6}
+
+	weekday, _ := d.ScheduleSlot(t, 1)
+	slots := week[weekday]
+	if len(slots) == 0 {
+		slots = d.Tempschedule.Day
+	}
+	if len(slots) == 0 {
+		return 0, false
+	}
+	_, slot := d.ScheduleSlot(t, len(slots))
+	return slots[slot], true
+}
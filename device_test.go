@@ -0,0 +1,103 @@
+package zont
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceLocation(t *testing.T) {
+	tests := []struct {
+		timezone int
+		name     string
+		offset   int
+	}{
+		{0, "UTC+00:00", 0},
+		{3, "UTC+03:00", 3 * 3600},
+		{-5, "UTC-05:00", -5 * 3600},
+		// offset in minutes
+		{330, "UTC+05:30", 330 * 60},
+		{-210, "UTC-03:30", -210 * 60},
+	}
+	for _, tt := range tests {
+		d := &Device{Timezone: tt.timezone}
+		name, offset := time.Unix(1700000000, 0).In(d.Location()).Zone()
+		if name != tt.name || offset != tt.offset {
+			t.Errorf("timezone %d: zone %s %d, want %s %d", tt.timezone, name, offset, tt.name, tt.offset)
+		}
+	}
+}
+
+func TestDeviceDay(t *testing.T) {
+	d := &Device{Timezone: 5}
+	// 20:00 UTC is 01:00 of next day in UTC+5
+	start, end := d.Day(time.Date(2023, 11, 14, 20, 0, 0, 0, time.UTC))
+	want := time.Date(2023, 11, 15, 0, 0, 0, 0, d.Location())
+	if !start.Equal(want) || !end.Equal(want.AddDate(0, 0, 1)) {
+		t.Errorf("day = %v - %v, want %v", start, end, want)
+	}
+	if start.Location().String() != d.Location().String() {
+		t.Errorf("day is in %v", start.Location())
+	}
+}
+
+func TestDeviceDays(t *testing.T) {
+	d := &Device{Timezone: 5}
+	from := time.Date(2023, 11, 14, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		to   time.Time
+		want int
+	}{
+		// day of from is included
+		{from, 1},
+		{from.Add(time.Hour), 1},
+		// end of local day is not included
+		{time.Date(2023, 11, 15, 19, 0, 0, 0, time.UTC), 1},
+		{time.Date(2023, 11, 15, 19, 0, 1, 0, time.UTC), 2},
+		{from.AddDate(0, 0, 3), 4},
+	}
+	for _, tt := range tests {
+		days := d.Days(from, tt.to)
+		if len(days) != tt.want {
+			t.Errorf("Days to %v = %v, want %d days", tt.to, days, tt.want)
+			continue
+		}
+		for i, day := range days {
+			want := time.Date(2023, 11, 15+i, 0, 0, 0, 0, d.Location())
+			if !day.Equal(want) {
+				t.Errorf("day %d = %v, want %v", i, day, want)
+			}
+		}
+	}
+}
+
+func TestDeviceScheduleAt(t *testing.T) {
+	d := testDevice(t, `{"timezone":3,"tempschedule":{
+		"day":[18,21],
+		"week":{"2":[16,17,18,19]}}}`)
+
+	tests := []struct {
+		time time.Time
+		temp Celsius
+		ok   bool
+	}{
+		// Monday 11:00 device time, day schedule, first half of day
+		{time.Date(2023, 11, 13, 8, 0, 0, 0, time.UTC), 18 * Degree, true},
+		// Monday 12:00 device time, second half
+		{time.Date(2023, 11, 13, 9, 0, 0, 0, time.UTC), 21 * Degree, true},
+		// Wednesday 05:59 and 06:00 device time, week schedule of four slots
+		{time.Date(2023, 11, 15, 2, 59, 0, 0, time.UTC), 16 * Degree, true},
+		{time.Date(2023, 11, 15, 3, 0, 0, 0, time.UTC), 17 * Degree, true},
+		// Tuesday 23:30 UTC is Wednesday 02:30 device time
+		{time.Date(2023, 11, 14, 23, 30, 0, 0, time.UTC), 16 * Degree, true},
+	}
+	for _, tt := range tests {
+		temp, ok := d.ScheduleAt(tt.time)
+		if temp != tt.temp || ok != tt.ok {
+			t.Errorf("ScheduleAt(%v) = %s %v, want %s %v", tt.time, temp, ok, tt.temp, tt.ok)
+		}
+	}
+
+	if _, ok := (&Device{}).ScheduleAt(time.Now()); ok {
+		t.Error("device without schedule has schedule")
+	}
+}
@@ -0,0 +1,87 @@
+package zont
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WriteResult describe write sent by UpdateDevice or write helpers
+type WriteResult struct {
+	Time          time.Time       `json:"time"`
+	Operation     string          `json:"operation"`
+	DeviceID      int             `json:"device_id"`
+	CorrelationID string          `json:"correlation_id"`
+	Payload       json.RawMessage `json:"payload"`
+	DryRun        bool            `json:"dry_run"`
+	// Status is WriteSent, or result of WithConfirm, it is empty in dry run
+	Status WriteStatus `json:"status,omitempty"`
+}
+
+// SetDryRun switch client to read-only mode, writes are validated, logged and
+// audited but not sent, and they return success without confirmation. Setpoints
+// are validated with ValidateStrict unless write has WithValidation or WithClamp.
+func (cl *Client) SetDryRun(enable bool) {
+	cl.dryRun = enable
+}
+
+// DryRun return true when client is in read-only mode
+func (cl *Client) DryRun() bool {
+	return cl.dryRun
+}
+
+// WithDryRun validate and log one write without sending it
+func WithDryRun() WriteOption {
+	return func(o *writeOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithResult fill result with payload of write, with dry run it is payload
+// which would be sent
+func WithResult(result *WriteResult) WriteOption {
+	return func(o *writeOptions) {
+		o.result = result
+	}
+}
+
+// writeResult fill WriteResult requested by WithResult
+func (cl *Client) writeResult(operation string, options *writeOptions, data interface{}) {
+	if options.result == nil {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		ContextLogger.Error(err)
+	}
+	var head struct {
+		DeviceID int `json:"device_id"`
+	}
+	_ = json.Unmarshal(payload, &head)
+
+	*options.result = WriteResult{
+		Time:          time.Now(),
+		Operation:     operation,
+		DeviceID:      head.DeviceID,
+		CorrelationID: options.correlationID,
+		Payload:       payload,
+		DryRun:        options.dryRun,
+	}
+	if !options.dryRun {
+		options.result.Status = WriteSent
+	}
+}
+
+// dryRunWrite log write which is not sent in dry run mode
+func (cl *Client) dryRunWrite(operation string, options *writeOptions, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		ContextLogger.Error(err)
+		return err
+	}
+	ContextLogger.Infoln("dry run", operation, "not sent:", string(payload))
+
+	auditErr := cl.auditWrite(operation, options, data, nil)
+	cl.writeResult(operation, options, data)
+	return auditErr
+}
@@ -0,0 +1,69 @@
+package zont
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDryRunWriteHelpers(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[{"id":7}]}`, &updates))
+	cl.SetValidation(ValidateOff)
+	cl.SetDryRun(true)
+	var records []AuditRecord
+	cl.SetAuditSink(AuditFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	// dry run validates even with validation off
+	var setpointErr *SetpointError
+	if err := cl.SetTargetTemp(7, "1", 210); !errors.As(err, &setpointErr) {
+		t.Errorf("got %v, want SetpointError", err)
+	}
+
+	var result WriteResult
+	if err := cl.SetTargetTemp(7, "1", 210, WithClamp(), WithResult(&result)); err != nil {
+		t.Fatal(err)
+	}
+	var payload ThermostatData
+	if err := json.Unmarshal(result.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if temp := payload.ThermostatTargetTemps["1"].Temp; temp != DefaultMaxZoneTemp || !result.DryRun || result.Status != "" {
+		t.Errorf("clamped dry run: temp %s result %+v", temp, result)
+	}
+	if err := cl.SetTargetTemp(7, "1", 210, WithValidation(ValidateOff)); err != nil {
+		t.Errorf("explicit validation off: %v", err)
+	}
+
+	if err := cl.SetExtMode(7, 2, WithResult(&result)); err != nil || result.Operation != "set_ext_mode" || !result.DryRun {
+		t.Errorf("SetExtMode: %v %+v", err, result)
+	}
+	if err := cl.SetGuard(7, true, WithConfirm(time.Hour)); err != nil {
+		t.Errorf("SetGuard: %v", err)
+	}
+
+	if updates != 0 {
+		t.Errorf("dry run sent %d updates", updates)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d audit records, want 4", len(records))
+	}
+	for _, r := range records {
+		if r.Result != AuditDryRun {
+			t.Errorf("%s audit result %s, want %s", r.Operation, r.Result, AuditDryRun)
+		}
+	}
+
+	// single write without client dry run
+	cl.SetDryRun(false)
+	if err := cl.SetGuard(7, false, WithDryRun()); err != nil || updates != 0 {
+		t.Errorf("WithDryRun: %v, %d updates", err, updates)
+	}
+	if err := cl.SetGuard(7, false); err != nil || updates != 1 {
+		t.Errorf("write after dry run: %v, %d updates", err, updates)
+	}
+}
@@ -0,0 +1,203 @@
+package zont
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEfficiency = 0.9
+	// defaultGasCalorific is lower heating value of natural gas, kWh per m³
+	defaultGasCalorific = 9.3
+	defaultBaseTemp     = 18
+)
+
+// BoilerPowers is nominal power of boiler models in kW by "vendor model" as in
+// Device.BoilerInfo, add your boilers before calling EstimateEnergy
+var BoilerPowers = map[string]float64{}
+
+// EnergyOptions set boiler and fuel parameters of EstimateEnergy
+type EnergyOptions struct {
+	// NominalPower of boiler in kW, when zero it is looked up in BoilerPowers by BoilerVendor and BoilerModel
+	NominalPower float64
+	BoilerVendor string
+	BoilerModel  string
+	// Efficiency of boiler 0 - 1, 0.9 by default
+	Efficiency float64
+	// GasCalorific is kWh in one m³ of gas, 9.3 by default
+	GasCalorific float64
+	// BaseTemp of degree days, 18 °C by default
+	BaseTemp float64
+	// Outdoor is outdoor temperature series used for degree days
+	Outdoor Series
+	// OutdoorTemp is current outdoor temperature, for example Device.InternetWeather,
+	// it is used only for day of Now when it has no Outdoor samples
+	OutdoorTemp *float64
+	// Now is current time, time.Now() by default
+	Now time.Time
+	// Location of day boundaries, device local days (Device.Location) by default
+	Location *time.Location
+}
+
+// EnergyOptionsForDevice return options with boiler, weather and time zone of device
+func EnergyOptionsForDevice(d *Device, efficiency float64) EnergyOptions {
+	opts := EnergyOptions{
+		BoilerVendor: d.BoilerInfo.Vendor,
+		BoilerModel:  d.BoilerInfo.Model,
+		Efficiency:   efficiency,
+		Location:     d.Location(),
+	}
+	// 0 °C is valid weather, so presence is checked in device JSON
+	if value, ok := rawMap(d)["internet_weather"]; ok && value != nil {
+		weather := d.InternetWeather.Float64()
+		opts.OutdoorTemp = &weather
+	}
+	return opts
+}
+
+// EnergyPeriod is energy estimation of day or month
+type EnergyPeriod struct {
+	Start       time.Time
+	BurnerHours float64
+	// HeatKWh is heat produced by boiler
+	HeatKWh float64
+	// FuelKWh is energy of burned gas
+	FuelKWh float64
+	GasM3   float64
+	// DegreeDays is sum of BaseTemp minus mean outdoor temperature of days
+	DegreeDays float64
+	// KWhPerDegreeDay is HeatKWh normalized by DegreeDays, zero without degree days
+	KWhPerDegreeDay float64
+}
+
+// EnergyReport is result of EstimateEnergy
+type EnergyReport struct {
+	DeviceID     int
+	NominalPower float64
+	Days         []EnergyPeriod
+	Months       []EnergyPeriod
+}
+
+// EstimateEnergy estimate heat and gas from burner runtime and modulation of
+// thermostat_work history of d. Without ot.rml burner is taken as working at full power.
+func EstimateEnergy(d *Device, h *History, opts EnergyOptions) (*EnergyReport, error) {
+	power := opts.NominalPower
+	if power <= 0 {
+		key := strings.TrimSpace(opts.BoilerVendor + " " + opts.BoilerModel)
+		power = BoilerPowers[key]
+		if power <= 0 {
+			return nil, fmt.Errorf("nominal power of boiler %q is unknown", key)
+		}
+	}
+	if opts.Efficiency <= 0 {
+		opts.Efficiency = defaultEfficiency
+	}
+	if opts.GasCalorific <= 0 {
+		opts.GasCalorific = defaultGasCalorific
+	}
+	if opts.BaseTemp == 0 {
+		opts.BaseTemp = defaultBaseTemp
+	}
+	if opts.Location == nil {
+		opts.Location = deviceLocation(d)
+	}
+
+	days := map[time.Time]*EnergyPeriod{}
+	dayOf := func(start time.Time) *EnergyPeriod {
+		d, ok := days[start]
+		if !ok {
+			d = &EnergyPeriod{Start: start}
+			days[start] = d
+		}
+		return d
+	}
+
+	modulation := h.Series["thermostat_work/ot/rml"]
+	for _, seg := range burnerSegments(h) {
+		if !seg.flame {
+			continue
+		}
+		splitDays(seg.start, seg.end, opts.Location, func(start time.Time, from, to int64) {
+			d := dayOf(start)
+			seconds := float64(to - from)
+			d.BurnerHours += seconds / 3600
+
+			load := seconds
+			if len(modulation) > 0 {
+				sum, covered := integrate(modulation, from, to)
+				// part before first modulation sample is taken at full power
+				load = sum/100 + (seconds - covered)
+			}
+			d.HeatKWh += power * load / 3600
+		})
+	}
+
+	// days without burner work still count for degree days
+	outdoor := dailyMean(opts.Outdoor, opts.Location)
+	for start := range outdoor {
+		dayOf(start)
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	today := dayStart(opts.Now.Unix(), opts.Location)
+	for start, d := range days {
+		d.FuelKWh = d.HeatKWh / opts.Efficiency
+		d.GasM3 = d.FuelKWh / opts.GasCalorific
+
+		temp, ok := outdoor[start]
+		if !ok && opts.OutdoorTemp != nil && start.Equal(today) {
+			temp, ok = *opts.OutdoorTemp, true
+		}
+		if ok && temp < opts.BaseTemp {
+			d.DegreeDays = opts.BaseTemp - temp
+			d.KWhPerDegreeDay = d.HeatKWh / d.DegreeDays
+		}
+	}
+
+	report := &EnergyReport{DeviceID: h.DeviceID, NominalPower: power}
+	months := map[time.Time]*EnergyPeriod{}
+	for _, d := range days {
+		report.Days = append(report.Days, *d)
+
+		start := time.Date(d.Start.Year(), d.Start.Month(), 1, 0, 0, 0, 0, opts.Location)
+		m, ok := months[start]
+		if !ok {
+			m = &EnergyPeriod{Start: start}
+			months[start] = m
+		}
+		m.BurnerHours += d.BurnerHours
+		m.HeatKWh += d.HeatKWh
+		m.FuelKWh += d.FuelKWh
+		m.GasM3 += d.GasM3
+		m.DegreeDays += d.DegreeDays
+	}
+	for _, m := range months {
+		if m.DegreeDays > 0 {
+			m.KWhPerDegreeDay = m.HeatKWh / m.DegreeDays
+		}
+		report.Months = append(report.Months, *m)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Start.Before(report.Days[j].Start) })
+	sort.Slice(report.Months, func(i, j int) bool { return report.Months[i].Start.Before(report.Months[j].Start) })
+
+	return report, nil
+}
+
+// dailyMean return mean of samples by day start in loc
+func dailyMean(s Series, loc *time.Location) map[time.Time]float64 {
+	sums := map[time.Time]float64{}
+	counts := map[time.Time]int{}
+	for _, sample := range s {
+		day := dayStart(sample.Time, loc)
+		sums[day] += sample.Value
+		counts[day]++
+	}
+	means := map[time.Time]float64{}
+	for day, sum := range sums {
+		means[day] = sum / float64(counts[day])
+	}
+	return means
+}
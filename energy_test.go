@@ -0,0 +1,72 @@
+package zont
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateEnergyDeviceLocalDays(t *testing.T) {
+	d, h := localDayHistory()
+	report, err := EstimateEnergy(d, h, EnergyOptions{NominalPower: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Days) != 1 || !report.Days[0].Start.Equal(time.Date(2023, 11, 15, 0, 0, 0, 0, d.Location())) {
+		t.Errorf("days = %+v", report.Days)
+	}
+	if report.Days[0].HeatKWh != 24 {
+		t.Errorf("heat = %v kWh, want 24", report.Days[0].HeatKWh)
+	}
+}
+
+func TestEstimateEnergyOutdoorTempOnlyToday(t *testing.T) {
+	d, h := localDayHistory()
+	// burner works one hour on 2023-11-15 and one minute at 23:59 of 2023-11-16 device time
+	now := time.Date(2023, 11, 16, 23, 59, 30, 0, d.Location())
+	h.Series["thermostat_work/ot/s"] = append(h.Series["thermostat_work/ot/s"],
+		Sample{Time: now.Unix() - 60, Value: OtStatusFlame | OtStatusCH},
+		Sample{Time: now.Unix(), Value: 0},
+	)
+	outdoor := 8.0
+	report, err := EstimateEnergy(d, h, EnergyOptions{NominalPower: 24, OutdoorTemp: &outdoor, Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Days) != 2 {
+		t.Fatalf("got %d days, want 2", len(report.Days))
+	}
+	today := time.Date(2023, 11, 16, 0, 0, 0, 0, d.Location())
+	for _, day := range report.Days {
+		want := 0.0
+		if day.Start.Equal(today) {
+			want = 10
+		}
+		if day.DegreeDays != want {
+			t.Errorf("%s degree days = %v, want %v", day.Start, day.DegreeDays, want)
+		}
+	}
+}
+
+func TestEnergyOptionsForDevice(t *testing.T) {
+	tests := []struct {
+		device  string
+		outdoor *float64
+	}{
+		{`{"id":7,"timezone":3}`, nil},
+		{`{"id":7,"timezone":3,"internet_weather":null}`, nil},
+		{`{"id":7,"timezone":3,"internet_weather":0}`, new(float64)},
+		{`{"id":7,"timezone":3,"internet_weather":-4.5}`, func() *float64 { v := -4.5; return &v }()},
+	}
+	for _, tt := range tests {
+		opts := EnergyOptionsForDevice(testDevice(t, tt.device), 0.85)
+		switch {
+		case (opts.OutdoorTemp == nil) != (tt.outdoor == nil):
+			t.Errorf("%s: outdoor temp %v, want %v", tt.device, opts.OutdoorTemp, tt.outdoor)
+		case opts.OutdoorTemp != nil && *opts.OutdoorTemp != *tt.outdoor:
+			t.Errorf("%s: outdoor temp %v, want %v", tt.device, *opts.OutdoorTemp, *tt.outdoor)
+		}
+		if _, offset := time.Now().In(opts.Location).Zone(); offset != 3*3600 || opts.Efficiency != 0.85 {
+			t.Errorf("%s: options %+v", tt.device, opts)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package export write ZONT load_data history as CSV, JSON Lines or Parquet.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dematron/go-zont"
+)
+
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatParquet Format = "parquet"
+)
+
+// Row is one exported sample
+type Row struct {
+	DeviceID  int       `json:"device_id" parquet:"device_id"`
+	Serial    string    `json:"serial" parquet:"serial"`
+	Series    string    `json:"series" parquet:"series"`
+	Sensor    string    `json:"sensor" parquet:"sensor"`
+	Time      time.Time `json:"time" parquet:"time,timestamp"`
+	LocalTime string    `json:"local_time" parquet:"local_time"`
+	Value     float64   `json:"value" parquet:"value"`
+	Unit      string    `json:"unit" parquet:"unit"`
+}
+
+// Writer stream rows in one of formats
+type Writer interface {
+	Write(Row) error
+	// Close flush buffered rows, underlying io.Writer is not closed
+	Close() error
+}
+
+// NewWriter return Writer of format writing to w
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatJSONL:
+		return newJSONLWriter(w), nil
+	case FormatParquet:
+		return newParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// Rows convert history of device to rows
+func Rows(device *zont.Device, history *zont.History) []Row {
+	loc := device.Location()
+
+	var rows []Row
+	for _, key := range history.Keys() {
+		sensor := history.Names[key]
+		if sensor == "" {
+			sensor = key
+		}
+		unit := zont.SeriesUnit(key)
+		for _, s := range history.Series[key] {
+			t := time.Unix(s.Time, 0)
+			rows = append(rows, Row{
+				DeviceID:  device.ID,
+				Serial:    device.Serial,
+				Series:    key,
+				Sensor:    sensor,
+				Time:      t.UTC(),
+				LocalTime: t.In(loc).Format(time.RFC3339),
+				Value:     s.Value,
+				Unit:      unit,
+			})
+		}
+	}
+	return rows
+}
+
+// Export load dataTypes history of device from from to to (not included) and write it to w.
+// Returned time is end of exported range, pass it as from to resume interrupted export.
+func Export(ctx context.Context, client *zont.Client, device *zont.Device, dataTypes []string, from, to time.Time, w Writer) (exportedUntil time.Time, err error) {
+	req := zont.HistoryRequest{
+		DeviceID:  device.ID,
+		DataTypes: dataTypes,
+		MinTime:   from.Unix(),
+		MaxTime:   to.Unix(),
+	}
+
+	until, err := client.LoadHistory(ctx, req, func(h *zont.History) error {
+		for _, row := range Rows(device, h) {
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return time.Unix(until, 0), err
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dematron/go-zont"
+)
+
+func testHistory() *zont.History {
+	h := zont.NewHistory(7)
+	h.Names["temperature/4096"] = "Living room"
+	h.Series["temperature/4096"] = zont.Series{{Time: 1700000000, Value: 21.5}, {Time: 1700003600, Value: 22}}
+	h.Series["thermostat_work/ot/rml"] = zont.Series{{Time: 1700000000, Value: 37.5}}
+	return h
+}
+
+func TestRows(t *testing.T) {
+	device := &zont.Device{ID: 7, Serial: "SN7", Timezone: 3}
+	rows := Rows(device, testHistory())
+
+	want := []Row{
+		{7, "SN7", "temperature/4096", "Living room", time.Unix(1700000000, 0).UTC(), "2023-11-15T01:13:20+03:00", 21.5, "°C"},
+		{7, "SN7", "temperature/4096", "Living room", time.Unix(1700003600, 0).UTC(), "2023-11-15T02:13:20+03:00", 22, "°C"},
+		{7, "SN7", "thermostat_work/ot/rml", "thermostat_work/ot/rml", time.Unix(1700000000, 0).UTC(), "2023-11-15T01:13:20+03:00", 37.5, "%"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d: got %+v, want %+v", i, rows[i], want[i])
+		}
+		if rows[i].Time.Location() != time.UTC {
+			t.Errorf("row %d: time in %v, want UTC", i, rows[i].Time.Location())
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"responses":[{"device_id":7,"ok":true,
+			"temperature":{"4096":{"name":"Living room","temperature":[[1700000000,21.5],[1700003600,22]]}}}]}`))
+	}))
+	defer srv.Close()
+
+	client := zont.NewClient("test", "test", "login", "password")
+	client.SetBaseURL(srv.URL + "/")
+	client.AuthTokenResponse = &zont.AuthTokenResponse{Token: "token", Ok: true}
+	client.SetRateLimit(0, 0)
+
+	device := &zont.Device{ID: 7, Serial: "SN7", Timezone: 3}
+	from, to := time.Unix(1699999200, 0), time.Unix(1700006400, 0)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	until, err := Export(context.Background(), client, device, []string{"temperature"}, from, to, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !until.Equal(to) {
+		t.Errorf("exported until %v, want %v", until, to)
+	}
+
+	want := `device_id,serial,series,sensor,time,local_time,value,unit
+7,SN7,temperature/4096,Living room,2023-11-14T22:13:20Z,2023-11-15T01:13:20+03:00,21.5,°C
+7,SN7,temperature/4096,Living room,2023-11-14T23:13:20Z,2023-11-15T02:13:20+03:00,22,°C
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(&strings.Builder{}, "xml"); err == nil {
+		t.Error("unknown format is accepted")
+	}
+}
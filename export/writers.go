@@ -0,0 +1,94 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{csv.NewWriter(w)}
+	header := []string{"device_id", "serial", "series", "sensor", "time", "local_time", "value", "unit"}
+	if err := c.w.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(row Row) error {
+	return c.w.Write([]string{
+		strconv.Itoa(row.DeviceID),
+		row.Serial,
+		row.Series,
+		row.Sensor,
+		row.Time.Format(time.RFC3339),
+		row.LocalTime,
+		strconv.FormatFloat(row.Value, 'f', -1, 64),
+		row.Unit,
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{json.NewEncoder(w)}
+}
+
+func (j *jsonlWriter) Write(row Row) error {
+	return j.enc.Encode(row)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// parquetRowGroup is count of rows buffered before they are written
+const parquetRowGroup = 10000
+
+type parquetWriter struct {
+	w    *parquet.GenericWriter[Row]
+	rows []Row
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{w: parquet.NewGenericWriter[Row](w)}
+}
+
+func (p *parquetWriter) Write(row Row) error {
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= parquetRowGroup {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	_, err := p.w.Write(p.rows)
+	p.rows = p.rows[:0]
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
@@ -0,0 +1,121 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dematron/go-zont"
+	"github.com/parquet-go/parquet-go"
+)
+
+func testRows() []Row {
+	return Rows(&zont.Device{ID: 7, Serial: "SN7", Timezone: 330}, testHistory())
+}
+
+func writeRows(t *testing.T, format Format, rows []Row) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func checkRows(t *testing.T, got, want []Row) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Time.Equal(w.Time) {
+			t.Errorf("row %d: time %v, want %v", i, g.Time, w.Time)
+		}
+		g.Time, w.Time = time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("row %d: got %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	rows := testRows()
+	records, err := csv.NewReader(bytes.NewReader(writeRows(t, FormatCSV, rows))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0][4] != "time" || records[0][5] != "local_time" {
+		t.Errorf("header %v", records[0])
+	}
+
+	var got []Row
+	for _, r := range records[1:] {
+		id, _ := strconv.Atoi(r[0])
+		tm, err := time.Parse(time.RFC3339, r[4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tm.Location() != time.UTC {
+			t.Errorf("time %s is not UTC", r[4])
+		}
+		value, _ := strconv.ParseFloat(r[6], 64)
+		got = append(got, Row{id, r[1], r[2], r[3], tm, r[5], value, r[7]})
+	}
+	checkRows(t, got, rows)
+	if got[0].LocalTime != "2023-11-15T03:43:20+05:30" {
+		t.Errorf("local time %s, want device time", got[0].LocalTime)
+	}
+}
+
+func TestJSONLRoundTrip(t *testing.T) {
+	rows := testRows()
+	dec := json.NewDecoder(bytes.NewReader(writeRows(t, FormatJSONL, rows)))
+
+	var got []Row
+	for dec.More() {
+		var row Row
+		if err := dec.Decode(&row); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	checkRows(t, got, rows)
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	rows := testRows()
+	data := writeRows(t, FormatParquet, rows)
+
+	got, err := parquet.Read[Row](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, got, rows)
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	rows := make([]Row, parquetRowGroup+5)
+	for i := range rows {
+		rows[i] = Row{DeviceID: 7, Series: "temperature/4096", Time: time.Unix(int64(1700000000+i*60), 0).UTC(), Value: float64(i)}
+	}
+	data := writeRows(t, FormatParquet, rows)
+
+	got, err := parquet.Read[Row](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, got, rows)
+}
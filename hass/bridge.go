@@ -0,0 +1,314 @@
+// Package hass publish ZONT devices to Home Assistant with MQTT discovery
+// and pass Home Assistant commands back to ZONT API.
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/dematron/go-zont"
+)
+
+// Config of MQTT bridge
+type Config struct {
+	// Broker url, for example tcp://localhost:1883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// DiscoveryPrefix of Home Assistant, "homeassistant" by default
+	DiscoveryPrefix string
+	// TopicPrefix for device state and command topics, "zont" by default
+	TopicPrefix string
+	// Interval between ZONT polls, one minute by default
+	Interval time.Duration
+}
+
+// commandQueueSize is count of MQTT commands waiting for poll goroutine
+const commandQueueSize = 16
+
+// Bridge publish ZONT devices as Home Assistant entities
+type Bridge struct {
+	cfg     Config
+	client  *zont.Client
+	mqtt    mqtt.Client
+	refresh chan struct{}
+	// commands from MQTT are run by poll goroutine, client is not safe for
+	// concurrent use while token is renewed
+	commands chan command
+
+	mu         sync.Mutex
+	devices    map[int]zont.Device
+	discovered map[int]bool
+}
+
+// command is Home Assistant command to device
+type command struct {
+	device  zont.Device
+	parts   []string
+	payload string
+}
+
+type zoneState struct {
+	Target  zont.Celsius  `json:"target"`
+	Current *zont.Celsius `json:"current"`
+}
+
+type deviceState struct {
+	Online       bool                    `json:"online"`
+	Guard        bool                    `json:"guard"`
+	BoilerFail   bool                    `json:"boiler_fail"`
+	Mode         string                  `json:"mode"`
+	Zones        map[string]zoneState    `json:"zones"`
+	Thermometers map[string]zont.Celsius `json:"thermometers"`
+}
+
+// NewBridge return new bridge for client with cfg
+func NewBridge(client *zont.Client, cfg Config) *Bridge {
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = "homeassistant"
+	}
+	if cfg.TopicPrefix == "" {
+		cfg.TopicPrefix = "zont"
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "go-zont-bridge"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+
+	b := &Bridge{
+		cfg:        cfg,
+		client:     client,
+		refresh:    make(chan struct{}, 1),
+		commands:   make(chan command, commandQueueSize),
+		devices:    map[int]zont.Device{},
+		discovered: map[int]bool{},
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetWill(b.statusTopic(), "offline", 1, true).
+		SetOnConnectHandler(b.onConnect)
+	b.mqtt = mqtt.NewClient(opts)
+
+	return b
+}
+
+// Run connect to broker and poll ZONT until ctx is done
+func (b *Bridge) Run(ctx context.Context) error {
+	if t := b.mqtt.Connect(); t.Wait() && t.Error() != nil {
+		return t.Error()
+	}
+	defer func() {
+		b.publish(b.statusTopic(), "offline")
+		b.mqtt.Disconnect(250)
+	}()
+
+	ticker := time.NewTicker(b.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		b.poll()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-b.refresh:
+		case c := <-b.commands:
+			if err := b.command(&c.device, c.parts, c.payload); err != nil {
+				zont.ContextLogger.Error(err)
+			}
+		}
+	}
+}
+
+func (b *Bridge) statusTopic() string {
+	return b.cfg.TopicPrefix + "/bridge/status"
+}
+
+func (b *Bridge) deviceTopic(id int) string {
+	return fmt.Sprintf("%s/%d", b.cfg.TopicPrefix, id)
+}
+
+func (b *Bridge) onConnect(c mqtt.Client) {
+	b.publish(b.statusTopic(), "online")
+
+	filters := map[string]byte{
+		b.cfg.TopicPrefix + "/+/zone/+/target/set": 1,
+		b.cfg.TopicPrefix + "/+/mode/set":          1,
+		b.cfg.TopicPrefix + "/+/guard/set":         1,
+	}
+	if t := c.SubscribeMultiple(filters, b.onCommand); t.Wait() && t.Error() != nil {
+		zont.ContextLogger.Error(t.Error())
+	}
+
+	// Home Assistant restart lose not retained discovery, send it again
+	c.Subscribe(b.cfg.DiscoveryPrefix+"/status", 1, func(c mqtt.Client, m mqtt.Message) {
+		if string(m.Payload()) != "online" {
+			return
+		}
+		b.mu.Lock()
+		b.discovered = map[int]bool{}
+		b.mu.Unlock()
+		b.triggerRefresh()
+	})
+}
+
+func (b *Bridge) publish(topic string, payload any) {
+	t := b.mqtt.Publish(topic, 1, true, payload)
+	if t.Wait() && t.Error() != nil {
+		zont.ContextLogger.Error(t.Error())
+	}
+}
+
+func (b *Bridge) triggerRefresh() {
+	select {
+	case b.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// authorize get new ZONT token, false when login failed
+func (b *Bridge) authorize() bool {
+	b.client.AuthTokenResponse = nil
+	b.client.GetAuthToken()
+	return b.client.AuthTokenResponse != nil && b.client.AuthTokenResponse.Token != ""
+}
+
+// poll load devices from ZONT and publish discovery and state
+func (b *Bridge) poll() {
+	if b.client.AuthTokenResponse == nil || b.client.AuthTokenResponse.Token == "" {
+		if !b.authorize() {
+			return
+		}
+	}
+
+	resp := b.client.GetDevices()
+	if resp == nil || !resp.Ok {
+		// token expired, login again
+		if !b.authorize() {
+			return
+		}
+		resp = b.client.GetDevices()
+		if resp == nil || !resp.Ok {
+			return
+		}
+	}
+
+	for _, d := range resp.Devices {
+		d := d
+		b.mu.Lock()
+		b.devices[d.ID] = d
+		discovered := b.discovered[d.ID]
+		b.discovered[d.ID] = true
+		b.mu.Unlock()
+
+		if !discovered {
+			for _, e := range b.entities(&d) {
+				payload, err := json.Marshal(e.config)
+				if err != nil {
+					zont.ContextLogger.Error(err)
+					continue
+				}
+				b.publish(fmt.Sprintf("%s/%s/%s/config", b.cfg.DiscoveryPrefix, e.component, e.objectID), payload)
+			}
+		}
+
+		payload, err := json.Marshal(b.state(&d))
+		if err != nil {
+			zont.ContextLogger.Error(err)
+			continue
+		}
+		b.publish(b.deviceTopic(d.ID)+"/state", payload)
+	}
+}
+
+func (b *Bridge) state(d *zont.Device) deviceState {
+	s := deviceState{
+		Online:       d.Online,
+		Guard:        d.ThermostatEnableGuard,
+		Mode:         d.ExtModeNames()[d.ThermostatExtMode],
+		Zones:        map[string]zoneState{},
+		Thermometers: map[string]zont.Celsius{},
+	}
+	if d.Online {
+		s.BoilerFail = b.client.GetBoilerFail(d.ID)
+	}
+	if d.ThermostatTargetTemps != nil {
+		for zone, t := range *d.ThermostatTargetTemps {
+			z := zoneState{Target: t.Temp}
+			if current, ok := d.ZoneTemp(zone); ok {
+				z.Current = &current
+			}
+			s.Zones[zone] = z
+		}
+	}
+	for _, t := range d.Thermometers {
+		s.Thermometers[t.UUID] = t.LastValue
+	}
+	return s
+}
+
+// onCommand handle <prefix>/<device>/... set topics
+func (b *Bridge) onCommand(_ mqtt.Client, m mqtt.Message) {
+	parts := strings.Split(strings.TrimPrefix(m.Topic(), b.cfg.TopicPrefix+"/"), "/")
+	if len(parts) < 3 {
+		return
+	}
+	deviceID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		zont.ContextLogger.Error(err)
+		return
+	}
+	payload := strings.TrimSpace(string(m.Payload()))
+
+	b.mu.Lock()
+	d, known := b.devices[deviceID]
+	b.mu.Unlock()
+	if !known {
+		zont.ContextLogger.Infoln("Unknown device", deviceID)
+		return
+	}
+
+	// ZONT API can be slow, do not block MQTT client, state is polled again
+	// after command
+	select {
+	case b.commands <- command{d, parts[1:], payload}:
+	default:
+		zont.ContextLogger.Infoln("Command queue is full, command dropped", m.Topic())
+	}
+}
+
+func (b *Bridge) command(d *zont.Device, parts []string, payload string) error {
+	switch {
+	case parts[0] == "zone" && len(parts) == 4:
+		temp, err := strconv.ParseFloat(payload, 64)
+		if err != nil {
+			return err
+		}
+		return b.client.SetTargetTemp(d.ID, parts[1], temp)
+	case parts[0] == "mode":
+		mode, ok := modeByName(d, payload)
+		if !ok {
+			return fmt.Errorf("unknown mode %q for device %d", payload, d.ID)
+		}
+		return b.client.SetExtMode(d.ID, mode)
+	case parts[0] == "guard":
+		return b.client.SetGuard(d.ID, strings.EqualFold(payload, "ON"))
+	}
+	return fmt.Errorf("unknown command topic %s", strings.Join(parts, "/"))
+}
@@ -0,0 +1,224 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	broker "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"github.com/dematron/go-zont"
+)
+
+const testDevice = `{"ok":true,"devices":[{
+	"id":7,"name":"Boiler room","online":true,"serial":"A1",
+	"thermostat_target_temps":{"1":{"manual":false,"temp":20}},
+	"thermostat_ext_modes_config":{"1":{"active":true,"name":"Comfort"},"2":{"active":true,"name":"Eco"}},
+	"thermometers":[{"uuid":"t1","name":"Hall","last_value":19.5}]
+}]}`
+
+// startBroker run embedded MQTT broker and return its url
+func startBroker(t *testing.T) string {
+	t.Helper()
+	server := broker.New(&broker.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return "tcp://" + tcp.Address()
+}
+
+// fakeZont is ZONT API accepting only token "fresh"
+type fakeZont struct {
+	mu      sync.Mutex
+	logins  int
+	updates chan map[string]any
+}
+
+func (f *fakeZont) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if method == "get_authtoken" {
+		f.mu.Lock()
+		f.logins++
+		f.mu.Unlock()
+		w.Write([]byte(`{"ok":true,"token":"fresh"}`))
+		return
+	}
+	if r.Header.Get("X-ZONT-Token") != "fresh" {
+		w.Write([]byte(`{"ok":false,"error":"invalid_token"}`))
+		return
+	}
+
+	switch method {
+	case "devices":
+		w.Write([]byte(testDevice))
+	case "load_data":
+		w.Write([]byte(`{"ok":true,"responses":[{"device_id":7,"ok":true,"thermostat_work":{"fail":[[1700000000,0]]}}]}`))
+	case "update_device":
+		body := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.updates <- body
+		w.Write([]byte(`{"ok":true}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// messages collect retained messages by topic
+type messages struct {
+	mu     sync.Mutex
+	topics map[string][]byte
+}
+
+func (m *messages) wait(t *testing.T, topic string) []byte {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		payload, ok := m.topics[topic]
+		m.mu.Unlock()
+		if ok {
+			return payload
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no message on %s", topic)
+	return nil
+}
+
+func TestBridge(t *testing.T) {
+	brokerURL := startBroker(t)
+	api := &fakeZont{updates: make(chan map[string]any, 10)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	client := zont.NewClient("test", "test", "login", "password")
+	client.SetBaseURL(srv.URL + "/")
+	// expired token must be replaced by new login
+	client.AuthTokenResponse = &zont.AuthTokenResponse{Token: "expired"}
+
+	bridge := NewBridge(client, Config{Broker: brokerURL, ClientID: "bridge", Interval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bridge.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	received := &messages{topics: map[string][]byte{}}
+	sub := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(brokerURL).SetClientID("test"))
+	if tok := sub.Connect(); tok.Wait() && tok.Error() != nil {
+		t.Fatal(tok.Error())
+	}
+	t.Cleanup(func() { sub.Disconnect(0) })
+	tok := sub.Subscribe("#", 1, func(_ mqtt.Client, m mqtt.Message) {
+		received.mu.Lock()
+		received.topics[m.Topic()] = m.Payload()
+		received.mu.Unlock()
+	})
+	if tok.Wait() && tok.Error() != nil {
+		t.Fatal(tok.Error())
+	}
+
+	t.Run("discovery", func(t *testing.T) {
+		var climate map[string]any
+		if err := json.Unmarshal(received.wait(t, "homeassistant/climate/zont_7_zone_1/config"), &climate); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{
+			"unique_id":                 "zont_7_zone_1",
+			"temperature_command_topic": "zont/7/zone/1/target/set",
+			"preset_mode_command_topic": "zont/7/mode/set",
+			"temp_step":                 0.1,
+		}
+		for key, value := range want {
+			if climate[key] != value {
+				t.Errorf("climate %s = %v, want %v", key, climate[key], value)
+			}
+		}
+		if modes, _ := json.Marshal(climate["preset_modes"]); string(modes) != `["Comfort","Eco"]` {
+			t.Errorf("climate preset_modes = %s", modes)
+		}
+
+		var sensor map[string]any
+		if err := json.Unmarshal(received.wait(t, "homeassistant/sensor/zont_7_t1/config"), &sensor); err != nil {
+			t.Fatal(err)
+		}
+		if sensor["device_class"] != "temperature" || sensor["state_topic"] != "zont/7/state" {
+			t.Errorf("sensor config %v", sensor)
+		}
+
+		var guard map[string]any
+		if err := json.Unmarshal(received.wait(t, "homeassistant/switch/zont_7_guard_switch/config"), &guard); err != nil {
+			t.Fatal(err)
+		}
+		if guard["command_topic"] != "zont/7/guard/set" {
+			t.Errorf("switch command_topic = %v", guard["command_topic"])
+		}
+
+		for _, s := range []string{"online", "guard", "boiler_fail"} {
+			received.wait(t, "homeassistant/binary_sensor/zont_7_"+s+"/config")
+		}
+
+		var state map[string]any
+		if err := json.Unmarshal(received.wait(t, "zont/7/state"), &state); err != nil {
+			t.Fatal(err)
+		}
+		if state["online"] != true || state["mode"] != "" {
+			t.Errorf("state %v", state)
+		}
+		if status := string(received.wait(t, "zont/bridge/status")); status != "online" {
+			t.Errorf("bridge status %s", status)
+		}
+
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		if api.logins != 1 {
+			t.Errorf("got %d logins, want 1", api.logins)
+		}
+	})
+
+	commands := []struct {
+		topic, payload string
+		key            string
+		want           string
+	}{
+		{"zont/7/zone/1/target/set", "21.5", "thermostat_target_temps", `{"1":{"manual":true,"temp":21.5}}`},
+		{"zont/7/mode/set", "Eco", "thermostat_ext_mode", `2`},
+		{"zont/7/guard/set", "ON", "thermostat_enable_guard", `true`},
+	}
+	for _, c := range commands {
+		t.Run(c.topic, func(t *testing.T) {
+			if tok := sub.Publish(c.topic, 1, false, c.payload); tok.Wait() && tok.Error() != nil {
+				t.Fatal(tok.Error())
+			}
+			select {
+			case body := <-api.updates:
+				if body["device_id"] != float64(7) {
+					t.Errorf("device_id = %v", body["device_id"])
+				}
+				if got, _ := json.Marshal(body[c.key]); string(got) != c.want {
+					t.Errorf("%s = %s, want %s", c.key, got, c.want)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("no update_device request")
+			}
+		})
+	}
+}
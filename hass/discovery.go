@@ -0,0 +1,152 @@
+package hass
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dematron/go-zont"
+)
+
+// entity is Home Assistant MQTT discovery config of one entity
+type entity struct {
+	component string
+	objectID  string
+	config    map[string]any
+}
+
+func (b *Bridge) deviceInfo(d *zont.Device) map[string]any {
+	info := map[string]any{
+		"identifiers":  []string{fmt.Sprintf("zont_%d", d.ID)},
+		"name":         d.Name,
+		"manufacturer": "ZONT",
+		"model":        d.DeviceType.Name,
+	}
+	if len(d.FirmwareVersion) > 0 {
+		info["sw_version"] = fmt.Sprint(d.FirmwareVersion)
+	}
+	if d.Serial != "" {
+		info["serial_number"] = d.Serial
+	}
+	return info
+}
+
+// entities return discovery configs for all entities of device
+func (b *Bridge) entities(d *zont.Device) []entity {
+	base := b.deviceTopic(d.ID)
+	device := b.deviceInfo(d)
+	availability := []map[string]string{{"topic": b.statusTopic()}}
+
+	common := func(name, uniqueID string) map[string]any {
+		return map[string]any{
+			"name":         name,
+			"unique_id":    uniqueID,
+			"object_id":    uniqueID,
+			"device":       device,
+			"availability": availability,
+			"state_topic":  base + "/state",
+		}
+	}
+
+	var entities []entity
+
+	modes := d.ExtModeNames()
+	modeNames := make([]string, 0, len(modes))
+	for _, i := range sortedKeys(modes) {
+		modeNames = append(modeNames, modes[i])
+	}
+
+	if d.ThermostatTargetTemps != nil {
+		zones := make([]string, 0, len(*d.ThermostatTargetTemps))
+		for zone := range *d.ThermostatTargetTemps {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+
+		for _, zone := range zones {
+			id := fmt.Sprintf("zont_%d_zone_%s", d.ID, zone)
+			cfg := common(fmt.Sprintf("Zone %s", zone), id)
+			delete(cfg, "state_topic")
+			cfg["modes"] = []string{"heat"}
+			cfg["mode_state_topic"] = base + "/state"
+			cfg["mode_state_template"] = "heat"
+			cfg["temperature_unit"] = "C"
+			cfg["temp_step"] = d.TempStep().Float64()
+			cfg["current_temperature_topic"] = base + "/state"
+			cfg["current_temperature_template"] = fmt.Sprintf("{{ value_json.zones['%s'].current }}", zone)
+			cfg["temperature_state_topic"] = base + "/state"
+			cfg["temperature_state_template"] = fmt.Sprintf("{{ value_json.zones['%s'].target }}", zone)
+			cfg["temperature_command_topic"] = fmt.Sprintf("%s/zone/%s/target/set", base, zone)
+			if len(modeNames) > 0 {
+				cfg["preset_modes"] = modeNames
+				cfg["preset_mode_state_topic"] = base + "/state"
+				cfg["preset_mode_value_template"] = "{{ value_json.mode }}"
+				cfg["preset_mode_command_topic"] = base + "/mode/set"
+			}
+			entities = append(entities, entity{"climate", id, cfg})
+		}
+	}
+
+	for _, t := range d.Thermometers {
+		if t.UUID == "" {
+			continue
+		}
+		id := fmt.Sprintf("zont_%d_%s", d.ID, t.UUID)
+		cfg := common(t.Name, id)
+		cfg["device_class"] = "temperature"
+		cfg["state_class"] = "measurement"
+		cfg["unit_of_measurement"] = "°C"
+		cfg["value_template"] = fmt.Sprintf("{{ value_json.thermometers['%s'] }}", t.UUID)
+		entities = append(entities, entity{"sensor", id, cfg})
+	}
+
+	binary := []struct {
+		key, name, class string
+	}{
+		{"online", "Online", "connectivity"},
+		{"guard", "Guard", "safety"},
+		{"boiler_fail", "Boiler fail", "problem"},
+	}
+	for _, s := range binary {
+		id := fmt.Sprintf("zont_%d_%s", d.ID, s.key)
+		cfg := common(s.name, id)
+		cfg["device_class"] = s.class
+		cfg["value_template"] = fmt.Sprintf("{{ 'ON' if value_json.%s else 'OFF' }}", s.key)
+		entities = append(entities, entity{"binary_sensor", id, cfg})
+	}
+
+	id := fmt.Sprintf("zont_%d_guard_switch", d.ID)
+	cfg := common("Guard arm", id)
+	cfg["command_topic"] = base + "/guard/set"
+	cfg["value_template"] = "{{ 'ON' if value_json.guard else 'OFF' }}"
+	cfg["icon"] = "mdi:shield-home"
+	entities = append(entities, entity{"switch", id, cfg})
+
+	return entities
+}
+
+func sortedKeys(m map[int]string) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// modeByName return number of active extended mode of device by name or number
+func modeByName(d *zont.Device, name string) (int, bool) {
+	names := d.ExtModeNames()
+	for i, n := range names {
+		if n == name {
+			return i, true
+		}
+	}
+	// mode number is accepted too
+	if i, err := strconv.Atoi(name); err == nil {
+		if _, ok := names[i]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,39 @@
+package hass
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dematron/go-zont"
+)
+
+func TestModeByName(t *testing.T) {
+	d := &zont.Device{}
+	if err := json.Unmarshal([]byte(`{"thermostat_ext_modes_config":{
+		"1":{"active":true,"name":"Comfort"},
+		"2":{"active":true,"name":"Eco"},
+		"3":{"active":false,"name":"Away"}}}`), d); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		mode int
+		ok   bool
+	}{
+		{"Comfort", 1, true},
+		{"Eco", 2, true},
+		{"2", 2, true},
+		{"Away", 0, false},
+		{"3", 0, false},
+		{"7", 0, false},
+		{"-1", 0, false},
+		{"eco", 0, false},
+	}
+	for _, tt := range tests {
+		mode, ok := modeByName(d, tt.name)
+		if mode != tt.mode || ok != tt.ok {
+			t.Errorf("modeByName(%q) = %d %v, want %d %v", tt.name, mode, ok, tt.mode, tt.ok)
+		}
+	}
+}
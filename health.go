@@ -0,0 +1,225 @@
+package zont
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type HealthIssueKind string
+
+const (
+	IssueOffline      HealthIssueKind = "offline"
+	IssueStale        HealthIssueKind = "stale"
+	IssueSensorSilent HealthIssueKind = "sensor_silent"
+	IssueSensorState  HealthIssueKind = "sensor_state"
+	IssueFlatLine     HealthIssueKind = "flat_line"
+	IssueGap          HealthIssueKind = "gap"
+	// IssueHistoryError is history of online device which failed to load
+	IssueHistoryError HealthIssueKind = "history_error"
+)
+
+// HealthOptions set thresholds of CheckHealth
+type HealthOptions struct {
+	// StaleAfter is time without data from controller to report it, 15 minutes by default
+	StaleAfter time.Duration
+	// SensorSilentAfter is time without thermometer value to report it, one hour by default
+	SensorSilentAfter time.Duration
+	// FlatLineAfter is time of unchanged value to report it, 6 hours by default
+	FlatLineAfter time.Duration
+	// GapAfter is time between history samples or from last sample to Now to report
+	// gap, 30 minutes by default
+	GapAfter time.Duration
+	// Now is time of check, current time by default
+	Now time.Time
+}
+
+// HealthIssue is one problem found by CheckHealth
+type HealthIssue struct {
+	Kind HealthIssueKind
+	// Sensor is thermometer name or series key, empty for controller issues
+	Sensor  string
+	Since   time.Time
+	Until   time.Time
+	Message string
+}
+
+// HealthReport is health of one device
+type HealthReport struct {
+	DeviceID    int
+	Name        string
+	Serial      string
+	Online      bool
+	LastReceive time.Time
+	Issues      []HealthIssue
+}
+
+// OK return true when device has no issues
+func (r *HealthReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// String return report in human readable form
+func (r *HealthReport) String() string {
+	var b strings.Builder
+	status := "OK"
+	if !r.OK() {
+		status = fmt.Sprintf("%d issues", len(r.Issues))
+	}
+	fmt.Fprintf(&b, "%d %s (%s): %s\n", r.DeviceID, r.Name, r.Serial, status)
+	for _, i := range r.Issues {
+		fmt.Fprintf(&b, "  [%s] %s\n", i.Kind, i.Message)
+	}
+	return b.String()
+}
+
+func (o *HealthOptions) defaults() {
+	if o.StaleAfter <= 0 {
+		o.StaleAfter = 15 * time.Minute
+	}
+	if o.SensorSilentAfter <= 0 {
+		o.SensorSilentAfter = time.Hour
+	}
+	if o.FlatLineAfter <= 0 {
+		o.FlatLineAfter = 6 * time.Hour
+	}
+	if o.GapAfter <= 0 {
+		o.GapAfter = 30 * time.Minute
+	}
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+}
+
+// CheckHealth check device state and its history, history may be nil
+func CheckHealth(d *Device, h *History, opts HealthOptions) *HealthReport {
+	opts.defaults()
+
+	report := &HealthReport{
+		DeviceID: d.ID,
+		Name:     d.Name,
+		Serial:   d.Serial,
+		Online:   d.Online,
+	}
+	add := func(i HealthIssue) {
+		report.Issues = append(report.Issues, i)
+	}
+
+	if d.LastReceiveTime > 0 {
+		report.LastReceive = d.LastReceive()
+	}
+	silence := time.Duration(d.LastReceiveTimeRelative) * time.Second
+	if silence == 0 && !report.LastReceive.IsZero() {
+		silence = opts.Now.Sub(report.LastReceive)
+	}
+
+	if !d.Online {
+		add(HealthIssue{Kind: IssueOffline, Since: report.LastReceive,
+			Message: fmt.Sprintf("controller offline, last data %s ago", silence.Round(time.Minute))})
+	} else if silence > opts.StaleAfter {
+		add(HealthIssue{Kind: IssueStale, Since: report.LastReceive,
+			Message: fmt.Sprintf("controller online but silent for %s", silence.Round(time.Minute))})
+	}
+
+	for i := range d.Thermometers {
+		t := &d.Thermometers[i]
+		if !t.IsAssignedToSlot {
+			continue
+		}
+		if t.LastState != "" && t.LastState != "ok" {
+			add(HealthIssue{Kind: IssueSensorState, Sensor: t.Name,
+				Message: fmt.Sprintf("thermometer %s state %s", t.Name, t.LastState)})
+		}
+		if t.LastValueTime > 0 {
+			last := d.ThermometerTime(t)
+			if age := opts.Now.Sub(last); age > opts.SensorSilentAfter {
+				add(HealthIssue{Kind: IssueSensorSilent, Sensor: t.Name, Since: last,
+					Message: fmt.Sprintf("thermometer %s silent for %s", t.Name, age.Round(time.Minute))})
+			}
+		}
+	}
+
+	if h != nil {
+		for _, key := range h.Keys() {
+			name := h.Names[key]
+			if name == "" {
+				name = key
+			}
+			report.Issues = append(report.Issues, seriesIssues(name, h.Series[key], opts, d.Location())...)
+		}
+	}
+
+	return report
+}
+
+// seriesIssues find gaps and flat lines in series
+func seriesIssues(name string, s Series, opts HealthOptions, loc *time.Location) []HealthIssue {
+	var issues []HealthIssue
+	gap := int64(opts.GapAfter / time.Second)
+	flat := int64(opts.FlatLineAfter / time.Second)
+
+	runStart := 0
+	for i := 1; i <= len(s); i++ {
+		if i < len(s) && s[i].Time-s[i-1].Time > gap {
+			issues = append(issues, HealthIssue{Kind: IssueGap, Sensor: name,
+				Since: time.Unix(s[i-1].Time, 0).In(loc), Until: time.Unix(s[i].Time, 0).In(loc),
+				Message: fmt.Sprintf("%s has no data for %s", name, time.Duration(s[i].Time-s[i-1].Time)*time.Second)})
+		}
+		if i < len(s) && s[i].Value == s[runStart].Value {
+			continue
+		}
+		if d := s[i-1].Time - s[runStart].Time; d >= flat {
+			issues = append(issues, HealthIssue{Kind: IssueFlatLine, Sensor: name,
+				Since: time.Unix(s[runStart].Time, 0).In(loc), Until: time.Unix(s[i-1].Time, 0).In(loc),
+				Message: fmt.Sprintf("%s stuck at %v for %s", name, s[runStart].Value, time.Duration(d)*time.Second)})
+		}
+		runStart = i
+	}
+	if n := len(s); n > 0 && opts.Now.Unix()-s[n-1].Time > gap {
+		silence := time.Duration(opts.Now.Unix()-s[n-1].Time) * time.Second
+		issues = append(issues, HealthIssue{Kind: IssueGap, Sensor: name,
+			Since: time.Unix(s[n-1].Time, 0).In(loc), Until: opts.Now.In(loc),
+			Message: fmt.Sprintf("%s has no data for last %s", name, silence)})
+	}
+	return issues
+}
+
+// HealthReports check all devices of account with temperature history of last period
+// before opts.Now
+func (cl *Client) HealthReports(ctx context.Context, period time.Duration, opts HealthOptions) ([]*HealthReport, error) {
+	opts.defaults()
+	resp := cl.GetDevices()
+	if resp == nil {
+		return nil, fmt.Errorf("devices request failed")
+	}
+
+	ids := make([]int, 0, len(resp.Devices))
+	for _, d := range resp.Devices {
+		ids = append(ids, d.ID)
+	}
+	now := opts.Now
+	results := cl.LoadDataBatch(ctx, BatchRequest{
+		DeviceIDs: ids,
+		DataTypes: []string{"temperature"},
+		MinTime:   now.Add(-period).Unix(),
+		MaxTime:   now.Unix(),
+	})
+
+	reports := make([]*HealthReport, 0, len(resp.Devices))
+	for i := range resp.Devices {
+		d := &resp.Devices[i]
+		var h *History
+		r := results[d.ID]
+		if r != nil && r.Data != nil {
+			h = r.Data.History()
+		}
+		report := CheckHealth(d, h, opts)
+		if r != nil && r.Err != nil && d.Online {
+			report.Issues = append(report.Issues, HealthIssue{Kind: IssueHistoryError,
+				Message: fmt.Sprintf("history not loaded: %v", r.Err)})
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,136 @@
+package zont
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func issueKinds(issues []HealthIssue) []HealthIssueKind {
+	var kinds []HealthIssueKind
+	for _, i := range issues {
+		kinds = append(kinds, i.Kind)
+	}
+	return kinds
+}
+
+func TestCheckHealthDevice(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	thermometers := []Thermometer{
+		{Name: "ok", IsAssignedToSlot: true, LastState: "ok", LastValueTime: 1700000000 - 60},
+		{Name: "broken", IsAssignedToSlot: true, LastState: "failure", LastValueTime: 1700000000 - 60},
+		{Name: "silent", IsAssignedToSlot: true, LastState: "ok", LastValueTime: 1700000000 - 7200},
+		{Name: "unassigned", LastState: "failure", LastValueTime: 1},
+	}
+
+	tests := []struct {
+		name   string
+		device Device
+		want   []HealthIssueKind
+	}{
+		{"healthy", Device{Online: true, LastReceiveTime: 1700000000 - 60}, nil},
+		{"offline", Device{LastReceiveTime: 1700000000 - 3600}, []HealthIssueKind{IssueOffline}},
+		{"stale", Device{Online: true, LastReceiveTime: 1700000000 - 3600}, []HealthIssueKind{IssueStale}},
+		{"stale relative", Device{Online: true, LastReceiveTime: 1700000000, LastReceiveTimeRelative: 3600}, []HealthIssueKind{IssueStale}},
+		{"thermometers", Device{Online: true, LastReceiveTime: 1700000000, Thermometers: thermometers},
+			[]HealthIssueKind{IssueSensorState, IssueSensorSilent}},
+	}
+	for _, tt := range tests {
+		report := CheckHealth(&tt.device, nil, HealthOptions{Now: now})
+		if got := issueKinds(report.Issues); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		if report.OK() != (len(tt.want) == 0) {
+			t.Errorf("%s: OK() = %v", tt.name, report.OK())
+		}
+	}
+}
+
+func TestCheckHealthHistory(t *testing.T) {
+	d := &Device{Online: true, Timezone: 3, LastReceiveTime: 1700000000}
+	now := time.Unix(1700000000, 0)
+	t0 := now.Add(-12 * time.Hour).Unix()
+	var regular Series
+	for at := t0; at < now.Unix(); at += 600 {
+		regular = append(regular, Sample{at, float64(at % 7)})
+	}
+
+	tests := []struct {
+		name   string
+		series Series
+		want   []HealthIssueKind
+	}{
+		{"regular", regular, nil},
+		{"gap", Series{{t0, 20}, {t0 + 3600, 21}, {now.Unix() - 600, 22}}, []HealthIssueKind{IssueGap, IssueGap}},
+		{"trailing gap", Series{{t0, 20}, {t0 + 600, 21}}, []HealthIssueKind{IssueGap}},
+		{"flat line", Series{{t0, 20}, {t0 + 7*3600, 20}, {now.Unix() - 60, 21}}, []HealthIssueKind{IssueGap, IssueGap, IssueFlatLine}},
+	}
+	for _, tt := range tests {
+		h := NewHistory(7)
+		h.Series["temperature/4096"] = tt.series
+		h.Names["temperature/4096"] = "Room"
+
+		report := CheckHealth(d, h, HealthOptions{Now: now})
+		if got := issueKinds(report.Issues); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		for _, i := range report.Issues {
+			if i.Sensor != "Room" {
+				t.Errorf("%s: issue of %q, want Room", tt.name, i.Sensor)
+			}
+		}
+	}
+}
+
+func TestCheckHealthTrailingGap(t *testing.T) {
+	d := &Device{Online: true, Timezone: 3, LastReceiveTime: 1700000000}
+	now := time.Unix(1700000000, 0)
+	h := NewHistory(7)
+	h.Series["temperature/4096"] = Series{{1700000000 - 7200, 20}}
+
+	report := CheckHealth(d, h, HealthOptions{Now: now})
+	if len(report.Issues) != 1 {
+		t.Fatalf("got %v, want one gap", report.Issues)
+	}
+	gap := report.Issues[0]
+	if gap.Kind != IssueGap || gap.Since.Unix() != 1700000000-7200 || !gap.Until.Equal(now) {
+		t.Errorf("got %+v, want gap from last sample to now", gap)
+	}
+	if gap.Until.Location().String() != d.Location().String() {
+		t.Errorf("gap end in %v, want device time zone", gap.Until.Location())
+	}
+}
+
+func TestHealthReportsHistoryError(t *testing.T) {
+	now := time.Now()
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			fmt.Fprintf(w, `{"ok":true,"devices":[{"id":7,"online":true,"last_receive_time":%d},{"id":8,"online":true,"last_receive_time":%d}]}`,
+				now.Unix(), now.Unix())
+		case strings.HasSuffix(r.URL.Path, "/load_data"):
+			fmt.Fprintf(w, `{"ok":true,"responses":[{"device_id":7,"ok":true,"temperature":{"4096":{"temperature":[[%d,21]]}}},
+				{"device_id":8,"ok":false,"error":"device_not_found"}]}`, now.Unix()-60)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+
+	reports, err := cl.HealthReports(context.Background(), time.Hour, HealthOptions{Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want 2", len(reports))
+	}
+	if !reports[0].OK() {
+		t.Errorf("device 7: %v", reports[0].Issues)
+	}
+	if got := issueKinds(reports[1].Issues); !reflect.DeepEqual(got, []HealthIssueKind{IssueHistoryError}) {
+		t.Errorf("device 8: got %v, want %v", got, IssueHistoryError)
+	}
+}
@@ -0,0 +1,234 @@
+package zont
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistoryWindow = 24 * time.Hour
+	minHistoryWindow     = 10 * time.Minute
+)
+
+// History is decoded load_data series of one device.
+// Series key is data type and path inside it, for example "temperature/4096",
+// "thermostat_work/dhw_t" or "thermostat_work/ot/rml".
+type History struct {
+	DeviceID int
+	Series   map[string]Series
+	// Names of series, temperature sensors have names
+	Names map[string]string
+}
+
+// NewHistory return empty history of device with deviceId
+func NewHistory(deviceId int) *History {
+	return &History{DeviceID: deviceId, Series: map[string]Series{}, Names: map[string]string{}}
+}
+
+// History decode all series of device response
+func (r *DataResponse) History() *History {
+	h := NewHistory(r.DeviceID)
+	for id, t := range r.Temperature {
+		key := "temperature/" + id
+		h.Series[key] = DecodeSeries(t.Temperature)
+		if t.Name != "" {
+			h.Names[key] = t.Name
+		}
+	}
+
+	fields := map[string]json.RawMessage{}
+	if len(r.Raw) > 0 {
+		if err := json.Unmarshal(r.Raw, &fields); err != nil {
+			ContextLogger.Error(err)
+		}
+	}
+	for name, raw := range fields {
+		switch name {
+		case "device_id", "ok", "time_truncated", "timings", "error", "temperature":
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			ContextLogger.Error(err)
+			continue
+		}
+		walkSeries(name, value, h.Series)
+	}
+	return h
+}
+
+// walkSeries find arrays of [time, value] pairs in decoded json
+func walkSeries(path string, value any, series map[string]Series) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			walkSeries(path+"/"+k, child, series)
+		}
+	case []any:
+		pairs := make([][]any, 0, len(v))
+		for _, item := range v {
+			pair, ok := item.([]any)
+			if !ok {
+				return
+			}
+			pairs = append(pairs, pair)
+		}
+		series[path] = DecodeSeries(pairs)
+	}
+}
+
+// Merge add series of other history, samples with same time are kept once
+func (h *History) Merge(other *History) {
+	for key, s := range other.Series {
+		h.Series[key] = h.Series[key].Merge(s)
+	}
+	for key, name := range other.Names {
+		h.Names[key] = name
+	}
+}
+
+// Keys return sorted series keys
+func (h *History) Keys() []string {
+	keys := make([]string, 0, len(h.Series))
+	for k := range h.Series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DataType return data type of series key
+func DataType(key string) string {
+	dataType, _, _ := strings.Cut(key, "/")
+	return dataType
+}
+
+// span return first and last sample time of all series
+func (h *History) span() (first, last int64, ok bool) {
+	for _, s := range h.Series {
+		if len(s) == 0 {
+			continue
+		}
+		if !ok || s[0].Time < first {
+			first = s[0].Time
+		}
+		if !ok || s[len(s)-1].Time > last {
+			last = s[len(s)-1].Time
+		}
+		ok = true
+	}
+	return first, last, ok
+}
+
+// trim remove samples out of range from - to, to is not included
+func (h *History) trim(from, to int64) {
+	for key, s := range h.Series {
+		kept := s[:0]
+		for _, sample := range s {
+			if sample.Time >= from && sample.Time < to {
+				kept = append(kept, sample)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h.Series, key)
+			continue
+		}
+		h.Series[key] = kept
+	}
+}
+
+// HistoryRequest is load_data request of one device for long time range
+type HistoryRequest struct {
+	DeviceID  int
+	DataTypes []string
+	// MinTime and MaxTime is range of samples, MaxTime is not included
+	MinTime int64
+	MaxTime int64
+	// Window is max range of one load_data call, one day by default.
+	// Window is made smaller when server truncate response.
+	Window time.Duration
+}
+
+// LoadHistory load range of req split into windows, following time_truncated until
+// whole range is covered. handle is called for every loaded window in time order,
+// every sample is passed once even when it lies on window boundary.
+// Returned time is end of loaded range, use it as MinTime to resume interrupted load.
+func (cl *Client) LoadHistory(ctx context.Context, req HistoryRequest, handle func(*History) error) (loadedUntil int64, err error) {
+	window := int64(req.Window / time.Second)
+	if window <= 0 {
+		window = int64(defaultHistoryWindow / time.Second)
+	}
+	minWindow := int64(minHistoryWindow / time.Second)
+
+	from := req.MinTime
+	loadedUntil = req.MinTime
+	for from < req.MaxTime {
+		if err := ctx.Err(); err != nil {
+			return loadedUntil, err
+		}
+
+		to := from + window
+		if to > req.MaxTime {
+			to = req.MaxTime
+		}
+
+		responses, err := cl.LoadDataRaw(LoadDataRequest{Requests: []DataRequest{{
+			DeviceID:  req.DeviceID,
+			DataTypes: req.DataTypes,
+			MinTime:   from,
+			MaxTime:   to,
+		}}})
+		if err != nil {
+			return loadedUntil, err
+		}
+		resp, ok := responses[req.DeviceID]
+		if !ok {
+			return loadedUntil, errors.New("no load_data response for device")
+		}
+		if !resp.Ok {
+			return loadedUntil, errors.New("load_data failed: " + resp.Error)
+		}
+
+		h := resp.History()
+		if resp.TimeTruncated {
+			_, last, ok := h.span()
+			switch {
+			case ok && last > from && last < to:
+				// server returned beginning of window, continue after last sample
+				to = last
+				if window > minWindow {
+					window /= 2
+				}
+			case window > minWindow:
+				// ask same range with smaller window
+				window /= 2
+				continue
+			default:
+				ContextLogger.Infoln("load_data still truncated on minimal window", from, to)
+			}
+		}
+
+		// windows overlap on boundary, next window start at to
+		h.trim(from, to)
+		if err := handle(h); err != nil {
+			return loadedUntil, err
+		}
+		loadedUntil = to
+		from = to
+	}
+	return loadedUntil, nil
+}
+
+// LoadHistoryAll load whole range of req and return merged history
+func (cl *Client) LoadHistoryAll(ctx context.Context, req HistoryRequest) (*History, error) {
+	history := NewHistory(req.DeviceID)
+	_, err := cl.LoadHistory(ctx, req, func(h *History) error {
+		history.Merge(h)
+		return nil
+	})
+	return history, err
+}
@@ -0,0 +1,105 @@
+package zont
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// truncatingServer serve temperature sample every step seconds from start to end,
+// answer has at most limit samples and is marked time_truncated when cut
+func truncatingServer(t *testing.T, start, end, step int64, limit int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req LoadDataRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Requests) != 1 {
+			t.Errorf("bad request: %v", err)
+			return
+		}
+		dr := req.Requests[0]
+
+		var pairs [][]float64
+		truncated := false
+		for ts := start; ts <= end; ts += step {
+			if ts < dr.MinTime || ts > dr.MaxTime {
+				continue
+			}
+			if len(pairs) == limit {
+				truncated = true
+				break
+			}
+			pairs = append(pairs, []float64{float64(ts), float64(ts-start) / 100})
+		}
+
+		resp := map[string]any{
+			"ok": true,
+			"responses": []any{map[string]any{
+				"device_id":      dr.DeviceID,
+				"ok":             true,
+				"time_truncated": truncated,
+				"temperature":    map[string]any{"t1": map[string]any{"name": "Hall", "temperature": pairs}},
+			}},
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func TestLoadHistoryNoDuplicates(t *testing.T) {
+	const (
+		start = int64(1700000000)
+		step  = int64(600)
+		end   = start + 2*86400
+	)
+	cl := newTestClient(t, truncatingServer(t, start, end, step, 50))
+
+	req := HistoryRequest{DeviceID: 7, DataTypes: []string{"temperature"}, MinTime: start, MaxTime: end}
+	seen := map[int64]int{}
+	var times []int64
+	calls := 0
+	until, err := cl.LoadHistory(context.Background(), req, func(h *History) error {
+		calls++
+		for _, s := range h.Series["temperature/t1"] {
+			seen[s.Time]++
+			times = append(times, s.Time)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until != end {
+		t.Errorf("loaded until %d, want %d", until, end)
+	}
+	if calls < 4 {
+		t.Errorf("handle called %d times, server did not truncate", calls)
+	}
+
+	for ts := start; ts < end; ts += step {
+		if seen[ts] != 1 {
+			t.Errorf("sample %d delivered %d times", ts, seen[ts])
+		}
+	}
+	if seen[end] != 0 {
+		t.Errorf("sample at MaxTime delivered %d times", seen[end])
+	}
+	for i := 1; i < len(times); i++ {
+		if times[i] <= times[i-1] {
+			t.Fatalf("samples out of order at %d: %d after %d", i, times[i], times[i-1])
+		}
+	}
+
+	// resume from half of range must continue without overlap
+	req.MinTime = start + 86400
+	resumed := map[int64]int{}
+	if _, err := cl.LoadHistory(context.Background(), req, func(h *History) error {
+		for _, s := range h.Series["temperature/t1"] {
+			resumed[s.Time]++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != int(86400/step) {
+		t.Errorf("resumed load delivered %d samples, want %d", len(resumed), 86400/step)
+	}
+}
@@ -0,0 +1,72 @@
+// Package influx write decoded ZONT series to InfluxDB v2 using line protocol.
+package influx
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dematron/go-zont"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Measurement return measurement name of series key, OpenTherm series of
+// thermostat_work get own "opentherm" measurement
+func Measurement(key string) string {
+	if strings.HasPrefix(key, "thermostat_work/ot/") {
+		return "opentherm"
+	}
+	return zont.DataType(key)
+}
+
+// Lines convert history of device to line protocol lines with second precision
+func Lines(device *zont.Device, history *zont.History) []string {
+	var lines []string
+	for _, key := range history.Keys() {
+		prefix := linePrefix(device, history, key)
+		for _, s := range history.Series[key] {
+			lines = append(lines, prefix+" value="+strconv.FormatFloat(s.Value, 'f', -1, 64)+" "+strconv.FormatInt(s.Time, 10))
+		}
+	}
+	return lines
+}
+
+// linePrefix return measurement and tags of series key
+func linePrefix(device *zont.Device, history *zont.History, key string) string {
+	measurement := Measurement(key)
+	sensor := strings.TrimPrefix(key, zont.DataType(key)+"/")
+	if measurement == "opentherm" {
+		sensor = strings.TrimPrefix(sensor, "ot/")
+	}
+
+	tags := [][2]string{{"device_id", strconv.Itoa(device.ID)}}
+	if device.Serial != "" {
+		tags = append(tags, [2]string{"serial", device.Serial})
+	}
+	if name := history.Names[key]; name != "" {
+		tags = append(tags, [2]string{"name", name})
+	}
+	tags = append(tags, [2]string{"sensor", sensor})
+	if unit := zont.SeriesUnit(key); unit != "" {
+		tags = append(tags, [2]string{"unit", unit})
+	}
+	if parts := strings.Split(sensor, "/"); len(parts) > 1 && parts[0] == "zones" {
+		tags = append(tags, [2]string{"zone", parts[1]})
+	}
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+	// line protocol recommend tags sorted by key
+	sort.Slice(tags, func(i, j int) bool { return tags[i][0] < tags[j][0] })
+	for _, t := range tags {
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(t[0]))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(t[1]))
+	}
+	return b.String()
+}
@@ -0,0 +1,225 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+
+	"github.com/dematron/go-zont"
+)
+
+const (
+	defaultBatchSize = 5000
+	// defaultLateMargin is time GSM controllers can upload data late
+	defaultLateMargin = time.Hour
+)
+
+// Sink write line protocol to InfluxDB v2 HTTP API
+type Sink struct {
+	// URL of InfluxDB, for example http://localhost:8086
+	URL    string
+	Org    string
+	Bucket string
+	Token  string
+	// BatchSize is lines sent in one write request, 5000 by default
+	BatchSize int
+	// LateMargin is time before now which Sync load again, so data uploaded late
+	// by controller is written by next Sync. One hour by default
+	LateMargin time.Duration
+
+	httpClient *retryablehttp.Client
+}
+
+// NewSink return new sink, failed writes are retried with exponential backoff
+// up to maxRetries times
+func NewSink(url, org, bucket, token string, maxRetries int) *Sink {
+	retryClient := retryablehttp.NewClient()
+	retryClient.RetryMax = maxRetries
+	retryClient.Logger = nil
+
+	return &Sink{
+		URL:        strings.TrimRight(url, "/"),
+		Org:        org,
+		Bucket:     bucket,
+		Token:      token,
+		BatchSize:  defaultBatchSize,
+		LateMargin: defaultLateMargin,
+		httpClient: retryClient,
+	}
+}
+
+// Write send lines in batches
+func (s *Sink) Write(ctx context.Context, lines []string) error {
+	batch := s.BatchSize
+	if batch < 1 {
+		batch = defaultBatchSize
+	}
+	for start := 0; start < len(lines); start += batch {
+		end := start + batch
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := s.write(ctx, lines[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sink) write(ctx context.Context, lines []string) error {
+	params := url.Values{}
+	params.Set("org", s.Org)
+	params.Set("bucket", s.Bucket)
+	params.Set("precision", "s")
+
+	body := strings.Join(lines, "\n")
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/api/v2/write?"+params.Encode(), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Authorization", "Token "+s.Token)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("influxdb write failed: %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// measurements return measurements written for series of data type
+func measurements(dataType string) []string {
+	if dataType == "thermostat_work" {
+		return []string{dataType, "opentherm"}
+	}
+	return []string{dataType}
+}
+
+// LastPoint return time of last point of data type of device in bucket, ok is false
+// when bucket has no such points
+func (s *Sink) LastPoint(ctx context.Context, deviceId int, dataType string, lookback time.Duration) (last time.Time, ok bool, err error) {
+	var filter []string
+	for _, m := range measurements(dataType) {
+		filter = append(filter, fmt.Sprintf("r._measurement == %q", m))
+	}
+	query := fmt.Sprintf(`from(bucket: %q)
+  |> range(start: -%ds)
+  |> filter(fn: (r) => r.device_id == "%d")
+  |> filter(fn: (r) => %s)
+  |> keep(columns: ["_time"])
+  |> max(column: "_time")`, s.Bucket, int64(lookback/time.Second), deviceId, strings.Join(filter, " or "))
+
+	params := url.Values{}
+	params.Set("org", s.Org)
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/api/v2/query?"+params.Encode(), strings.NewReader(query))
+	if err != nil {
+		return last, false, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.flux")
+	req.Header.Set("Accept", "application/csv")
+	req.Header.Set("Authorization", "Token "+s.Token)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return last, false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(res.Body)
+		return last, false, fmt.Errorf("influxdb query failed: %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+
+	r := csv.NewReader(res.Body)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	column := -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return last, false, err
+		}
+		// every table has own header with own column order
+		if header := timeColumn(record); header >= 0 {
+			column = header
+			continue
+		}
+		if column < 0 || column >= len(record) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, record[column])
+		if err != nil {
+			continue
+		}
+		if !ok || t.After(last) {
+			last, ok = t, true
+		}
+	}
+	return last, ok, nil
+}
+
+// timeColumn return index of _time column when record is table header, -1 otherwise
+func timeColumn(record []string) int {
+	for i, name := range record {
+		if name == "_time" {
+			return i
+		}
+	}
+	return -1
+}
+
+// Sync write history of device since last point in bucket up to now. Every data
+// type continue from own last point, data types without points from lookback ago.
+// Last LateMargin is loaded again, rewritten points are replaced by InfluxDB. It is
+// safe to run Sync periodically, every run continue from previous one.
+func (s *Sink) Sync(ctx context.Context, client *zont.Client, device *zont.Device, dataTypes []string, lookback time.Duration) (syncedUntil time.Time, err error) {
+	now := time.Now()
+	start := now.Add(-lookback)
+
+	since := now.Add(-s.LateMargin)
+	for _, dataType := range dataTypes {
+		last, ok, err := s.LastPoint(ctx, device.ID, dataType, lookback)
+		if err != nil {
+			return start, err
+		}
+		if !ok {
+			since = start
+			break
+		}
+		// last point is already written
+		if next := last.Add(time.Second); next.Before(since) {
+			since = next
+		}
+	}
+	if since.Before(start) {
+		since = start
+	}
+
+	req := zont.HistoryRequest{
+		DeviceID:  device.ID,
+		DataTypes: dataTypes,
+		MinTime:   since.Unix(),
+		MaxTime:   now.Unix(),
+	}
+	until, err := client.LoadHistory(ctx, req, func(h *zont.History) error {
+		return s.Write(ctx, Lines(device, h))
+	})
+	return time.Unix(until, 0), err
+}
@@ -0,0 +1,252 @@
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dematron/go-zont"
+)
+
+func TestLines(t *testing.T) {
+	device := &zont.Device{}
+	device.ID = 7
+	device.Serial = "A 1"
+
+	h := zont.NewHistory(7)
+	h.Series["temperature/t1"] = zont.Series{{Time: 1700000000, Value: 21.5}}
+	h.Names["temperature/t1"] = "Hall, 1=x"
+	h.Series["thermostat_work/ot/rml"] = zont.Series{{Time: 1700000000, Value: 37}}
+	h.Series["thermostat_work/zones/1/target_temp"] = zont.Series{{Time: 1700000000, Value: 22}, {Time: 1700000060, Value: 22.5}}
+
+	want := []string{
+		`temperature,device_id=7,name=Hall\,\ 1\=x,sensor=t1,serial=A\ 1,unit=°C value=21.5 1700000000`,
+		`opentherm,device_id=7,sensor=rml,serial=A\ 1,unit=% value=37 1700000000`,
+		`thermostat_work,device_id=7,sensor=zones/1/target_temp,serial=A\ 1,unit=°C,zone=1 value=22 1700000000`,
+		`thermostat_work,device_id=7,sensor=zones/1/target_temp,serial=A\ 1,unit=°C,zone=1 value=22.5 1700000060`,
+	}
+	got := Lines(device, h)
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\n got %s\nwant %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMeasurement(t *testing.T) {
+	tests := map[string]string{
+		"temperature/t1":                      "temperature",
+		"thermostat_work/ot/bt":               "opentherm",
+		"thermostat_work/zones/1/target_temp": "thermostat_work",
+	}
+	for key, want := range tests {
+		if got := Measurement(key); got != want {
+			t.Errorf("Measurement(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// newTestSink return sink for handler with fast retries
+func newTestSink(t *testing.T, handler http.HandlerFunc) *Sink {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	s := NewSink(srv.URL+"/", "org", "bucket", "secret", 3)
+	s.httpClient.RetryWaitMin = time.Millisecond
+	s.httpClient.RetryWaitMax = time.Millisecond
+	return s
+}
+
+func TestWriteBatches(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	s := newTestSink(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v2/write" || q.Get("org") != "org" || q.Get("bucket") != "bucket" || q.Get("precision") != "s" {
+			t.Errorf("unexpected write url %s", r.URL)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Token secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s.BatchSize = 2
+
+	if err := s.Write(context.Background(), []string{"a", "b", "c", "d", "e"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a\nb", "c\nd", "e"}
+	if strings.Join(bodies, "|") != strings.Join(want, "|") {
+		t.Errorf("got batches %q, want %q", bodies, want)
+	}
+}
+
+func TestWriteRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int
+		fail     bool
+	}{
+		{"server error", []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusNoContent}, 3, false},
+		{"rate limited", []int{http.StatusTooManyRequests, http.StatusNoContent}, 2, false},
+		{"bad request is not retried", []int{http.StatusBadRequest}, 1, true},
+		{"retries exhausted", []int{500, 500, 500, 500}, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			s := newTestSink(t, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != "a\nb" {
+					t.Errorf("retry %d body %q", calls, body)
+				}
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			})
+
+			err := s.Write(context.Background(), []string{"a", "b"})
+			if (err != nil) != tt.fail {
+				t.Errorf("err = %v, want fail %v", err, tt.fail)
+			}
+			if calls != tt.calls {
+				t.Errorf("got %d calls, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestLastPoint(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want time.Time
+		ok   bool
+	}{
+		{"empty", "\r\n", time.Time{}, false},
+		{
+			"one table",
+			"#datatype,string,long,dateTime:RFC3339\r\n" +
+				"#group,false,false,false\r\n" +
+				"#default,_result,,\r\n" +
+				",result,table,_time\r\n" +
+				",,0,2023-11-14T22:13:20Z\r\n",
+			time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC), true,
+		},
+		{
+			"many tables",
+			",result,table,_time\r\n" +
+				",,0,2023-11-14T22:13:20Z\r\n" +
+				"\r\n" +
+				",result,table,_measurement,_time\r\n" +
+				",,1,opentherm,2023-11-14T22:15:00.5Z\r\n" +
+				"\r\n" +
+				",result,table,_time,_measurement\r\n" +
+				",,2,2023-11-14T22:14:00Z,temperature\r\n",
+			time.Date(2023, 11, 14, 22, 15, 0, 500000000, time.UTC), true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSink(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v2/query" || r.URL.Query().Get("org") != "org" {
+					t.Errorf("unexpected query url %s", r.URL)
+				}
+				query, _ := io.ReadAll(r.Body)
+				if !strings.Contains(string(query), `r.device_id == "7"`) || !strings.Contains(string(query), `from(bucket: "bucket")`) ||
+					!strings.Contains(string(query), `r._measurement == "thermostat_work" or r._measurement == "opentherm"`) {
+					t.Errorf("unexpected query %s", query)
+				}
+				w.Write([]byte(tt.csv))
+			})
+
+			last, ok, err := s.LastPoint(context.Background(), 7, "thermostat_work", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || !last.Equal(tt.want) {
+				t.Errorf("got %v %v, want %v %v", last, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	now := time.Now()
+	lastPoints := map[string]time.Time{
+		"temperature":     now.Add(-10 * time.Minute),
+		"thermostat_work": now.Add(-3 * time.Hour),
+	}
+	s := newTestSink(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/query" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		for measurement, last := range lastPoints {
+			if strings.Contains(string(query), fmt.Sprintf("r._measurement == %q", measurement)) {
+				fmt.Fprintf(w, ",result,table,_time\r\n,,0,%s\r\n", last.UTC().Format(time.RFC3339))
+				return
+			}
+		}
+		w.Write([]byte("\r\n"))
+	})
+
+	var mu sync.Mutex
+	var minTimes []int64
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req zont.LoadDataRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		minTimes = append(minTimes, req.Requests[0].MinTime)
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true,"responses":[{"device_id":7,"ok":true}]}`))
+	}))
+	t.Cleanup(api.Close)
+	client := zont.NewClient("test", "test", "login", "password")
+	client.SetBaseURL(api.URL + "/")
+	client.AuthTokenResponse = &zont.AuthTokenResponse{Token: "token"}
+	device := &zont.Device{ID: 7}
+
+	tests := []struct {
+		name      string
+		dataTypes []string
+		since     time.Time
+	}{
+		{"earliest data type", []string{"temperature", "thermostat_work"}, lastPoints["thermostat_work"].Add(time.Second)},
+		{"late margin", []string{"temperature"}, now.Add(-time.Hour)},
+		{"no points", []string{"temperature", "power"}, now.Add(-24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			minTimes = nil
+			mu.Unlock()
+			if _, err := s.Sync(context.Background(), client, device, tt.dataTypes, 24*time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(minTimes) == 0 {
+				t.Fatal("history is not loaded")
+			}
+			if diff := minTimes[0] - tt.since.Unix(); diff < -2 || diff > 2 {
+				t.Errorf("loaded since %s, want %s", time.Unix(minTimes[0], 0), tt.since)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package zont
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldChange is one changed field of device, Path is json path like "notifications.guard.numbers"
+type FieldChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+}
+
+// DevicePatch record changes made on copy of Device and build update_device payload
+// of changed top level fields. Changes are applied to JSON of device, so fields and
+// zones which Device does not model are sent back as they are.
+type DevicePatch struct {
+	original Device
+	// Device is working copy, change it directly or with Edit
+	Device Device
+	// base is JSON of original device
+	base map[string]interface{}
+	raw  map[string]interface{}
+}
+
+// NewDevicePatch return patch of device, device itself is not changed
+func NewDevicePatch(d *Device) *DevicePatch {
+	p := &DevicePatch{raw: map[string]interface{}{}}
+	p.original = copyDevice(d)
+	p.Device = copyDevice(d)
+	p.base = rawMap(d)
+	return p
+}
+
+// NewPatch load current state of device and return patch of it
+func (cl *Client) NewPatch(deviceId int) (*DevicePatch, error) {
+	cl.InvalidateDevices()
+	d, err := cl.Device(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return NewDevicePatch(d), nil
+}
+
+func copyDevice(d *Device) Device {
+	// deep copy through json, Device has maps and slices
+	c := Device{}
+	data, err := json.Marshal(d)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		ContextLogger.Error(err)
+		return *d
+	}
+	c.raw = d.raw
+	c.tempStep = d.tempStep
+	return c
+}
+
+// Edit change working copy with fn
+func (p *DevicePatch) Edit(fn func(d *Device)) *DevicePatch {
+	fn(&p.Device)
+	return p
+}
+
+// Set set update_device field, objects are merged into current value of field and
+// arrays of same length element by element. Use it for fields which Device does not have.
+func (p *DevicePatch) Set(field string, value interface{}) *DevicePatch {
+	p.raw[field] = jsonValue(value)
+	return p
+}
+
+func deviceMap(d *Device) map[string]interface{} {
+	m := map[string]interface{}{}
+	data, err := json.Marshal(d)
+	if err == nil {
+		err = json.Unmarshal(data, &m)
+	}
+	if err != nil {
+		ContextLogger.Error(err)
+	}
+	return m
+}
+
+// rawMap return JSON of device as map, typed fields when device has no JSON
+func rawMap(d *Device) map[string]interface{} {
+	if d.raw == nil {
+		return deviceMap(d)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(d.raw, &m); err != nil {
+		ContextLogger.Error(err)
+		return deviceMap(d)
+	}
+	return m
+}
+
+// jsonValue return v as decoded JSON, so it can be compared with device JSON
+func jsonValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		ContextLogger.Error(err)
+		return v
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		ContextLogger.Error(err)
+		return v
+	}
+	return value
+}
+
+// zeroLike return json zero value of same kind as v, fields with omitempty
+// disappear from json when set to zero but must still be sent
+func zeroLike(v interface{}) interface{} {
+	switch v.(type) {
+	case bool:
+		return false
+	case float64:
+		return 0.0
+	case string:
+		return ""
+	case []interface{}:
+		return []interface{}{}
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// fields return changed top level fields with new values. Top level objects are sent
+// whole because update_device is not known to merge nested objects, they are taken
+// from JSON of device with changed values replaced.
+func (p *DevicePatch) fields() map[string]interface{} {
+	before := deviceMap(&p.original)
+	after := deviceMap(&p.Device)
+
+	values := map[string]interface{}{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			values[key] = mergeChanges(p.base[key], before[key], value)
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			// omitempty field set to zero
+			values[key] = zeroLike(value)
+		}
+	}
+	for key, value := range p.raw {
+		current, ok := values[key]
+		if !ok {
+			current = p.base[key]
+		}
+		values[key] = mergeValue(current, value)
+	}
+
+	changed := map[string]interface{}{}
+	for key, value := range values {
+		if old, ok := p.base[key]; !ok || !reflect.DeepEqual(old, value) {
+			changed[key] = value
+		}
+	}
+	delete(changed, "id")
+	return changed
+}
+
+// mergeChanges apply change of typed value from before to after to base, which
+// is JSON of the same value with fields Device does not model
+func mergeChanges(base, before, after interface{}) interface{} {
+	if reflect.DeepEqual(before, after) {
+		return base
+	}
+	switch a := after.(type) {
+	case map[string]interface{}:
+		b, bOk := before.(map[string]interface{})
+		r, rOk := base.(map[string]interface{})
+		if !bOk || !rOk {
+			return after
+		}
+		merged := make(map[string]interface{}, len(r))
+		for key, value := range r {
+			merged[key] = value
+		}
+		for key, value := range a {
+			if !reflect.DeepEqual(b[key], value) {
+				merged[key] = mergeChanges(r[key], b[key], value)
+			}
+		}
+		for key, value := range b {
+			if _, ok := a[key]; !ok {
+				merged[key] = zeroLike(value)
+			}
+		}
+		return merged
+	case []interface{}:
+		b, bOk := before.([]interface{})
+		r, rOk := base.([]interface{})
+		if !bOk || !rOk || len(a) != len(b) || len(a) != len(r) {
+			return after
+		}
+		merged := make([]interface{}, len(a))
+		for i := range a {
+			merged[i] = mergeChanges(r[i], b[i], a[i])
+		}
+		return merged
+	}
+	return after
+}
+
+// mergeValue return value merged into current, see DevicePatch.Set
+func mergeValue(current, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c, ok := current.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		merged := make(map[string]interface{}, len(c))
+		for key, item := range c {
+			merged[key] = item
+		}
+		for key, item := range v {
+			merged[key] = mergeValue(c[key], item)
+		}
+		return merged
+	case []interface{}:
+		c, ok := current.([]interface{})
+		if !ok || len(c) != len(v) {
+			return value
+		}
+		merged := make([]interface{}, len(v))
+		for i := range v {
+			merged[i] = mergeValue(c[i], v[i])
+		}
+		return merged
+	}
+	return value
+}
+
+// Empty return true when nothing is changed
+func (p *DevicePatch) Empty() bool {
+	return len(p.fields()) == 0
+}
+
+// Payload return update_device request with device_id and changed fields only
+func (p *DevicePatch) Payload() map[string]interface{} {
+	payload := p.fields()
+	payload["device_id"] = p.original.ID
+	return payload
+}
+
+func (p *DevicePatch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Payload())
+}
+
+// Diff return changed fields down to nested values
+func (p *DevicePatch) Diff() []FieldChange {
+	var changes []FieldChange
+	for key, value := range p.fields() {
+		changes = append(changes, diffValues(key, p.base[key], value)...)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffValues(path string, old, new interface{}) []FieldChange {
+	oldMap, oldOk := old.(map[string]interface{})
+	newMap, newOk := new.(map[string]interface{})
+	if !oldOk || !newOk {
+		if reflect.DeepEqual(old, new) {
+			return nil
+		}
+		return []FieldChange{{Path: path, Old: old, New: new}}
+	}
+
+	var changes []FieldChange
+	for key, value := range newMap {
+		changes = append(changes, diffValues(path+"."+key, oldMap[key], value)...)
+	}
+	for key, value := range oldMap {
+		if _, ok := newMap[key]; !ok {
+			changes = append(changes, FieldChange{Path: path + "." + key, Old: value})
+		}
+	}
+	return changes
+}
+
+// String return human readable diff, one change per line
+func (p *DevicePatch) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "device %d (%s):\n", p.original.ID, p.original.Name)
+	changes := p.Diff()
+	if len(changes) == 0 {
+		b.WriteString("  no changes\n")
+	}
+	for _, c := range changes {
+		fmt.Fprintf(&b, "  %s\n", c)
+	}
+	return b.String()
+}
+
+// DryRun write diff and update_device payload to w without sending it
+func (p *DevicePatch) DryRun(w io.Writer) error {
+	payload, err := json.MarshalIndent(p.Payload(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%supdate_device payload:\n%s\n", p, payload)
+	return err
+}
+
+// ApplyPatch send changed fields of patch with UpdateDevice, empty patch is not sent.
+// WithConfirm is rejected.
+func (cl *Client) ApplyPatch(p *DevicePatch, opts ...WriteOption) error {
+	options := cl.writeOptions(opts)
+	if options.confirmTimeout > 0 {
+		ContextLogger.Error(ErrConfirmUnsupported)
+		return ErrConfirmUnsupported
+	}
+	if p.Empty() {
+		return nil
+	}
+	options.diff = p.Diff()
+	err := cl.updateDevice("apply_patch", options, p.Payload())
+	if err != nil {
+		ContextLogger.Error(err)
+		return err
+	}
+	cl.InvalidateDevices()
+	return nil
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
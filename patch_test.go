@@ -0,0 +1,112 @@
+package zont
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPatchSendsWholeObjects(t *testing.T) {
+	d := testDevice(t, `{"id":7,"name":"Boiler room","notifications":{
+		"guard":{"numbers":"+7900","on":"sms","off":"sms","extra":"call"},
+		"alarm":{"numbers":"+7911"}}}`)
+
+	p := NewDevicePatch(d).Edit(func(d *Device) {
+		d.Notifications.Guard.Numbers = "+7901"
+	})
+
+	payload := p.Payload()
+	if len(payload) != 2 || payload["device_id"] != 7 {
+		t.Fatalf("payload = %v", payload)
+	}
+	data, err := json.Marshal(payload["notifications"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notifications map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &notifications); err != nil {
+		t.Fatal(err)
+	}
+	guard := notifications["guard"]
+	if guard["numbers"] != "+7901" || guard["on"] != "sms" || guard["off"] != "sms" || guard["extra"] != "call" {
+		t.Errorf("guard is not sent whole: %v", guard)
+	}
+	if len(notifications["alarm"]) != 1 || notifications["alarm"]["numbers"] != "+7911" {
+		t.Errorf("sibling alarm is not sent as reported: %v", notifications["alarm"])
+	}
+	if _, ok := notifications["info"]; ok {
+		t.Errorf("unreported info is sent: %v", notifications["info"])
+	}
+
+	changes := p.Diff()
+	if len(changes) != 1 || changes[0].Path != "notifications.guard.numbers" || changes[0].New != "+7901" {
+		t.Errorf("diff = %v", changes)
+	}
+	if d.Notifications.Guard.Numbers != "+7900" {
+		t.Error("patch changed original device")
+	}
+}
+
+func TestPatchOmitemptyField(t *testing.T) {
+	d := testDevice(t, `{"id":7,"name":"Boiler room","thermostat_hysteresis":0.5}`)
+	p := NewDevicePatch(d).Edit(func(d *Device) {
+		d.ThermostatHysteresis = 0
+	})
+	payload := p.Payload()
+	if v, ok := payload["thermostat_hysteresis"]; !ok || v != 0.0 {
+		t.Errorf("zero value is not sent: %v", payload)
+	}
+	if NewDevicePatch(d).Empty() == false {
+		t.Error("untouched patch is not empty")
+	}
+}
+
+func TestPatchKeepsUnmodelledZones(t *testing.T) {
+	d := testDevice(t, `{"id":7,
+		"thermostat_ext_modes_config":{
+			"1":{"active":true,"name":"Comfort","zone_temp":{"1":21,"2":19},"zone_sensors":{"1":null,"2":"uuid-2"}},
+			"2":{"active":true,"name":"Eco","schedule_number":1}},
+		"thermometers":[{"uuid":"uuid-1","name":"Hall","offset":-0.5,"last_value":20.5}]}`)
+
+	p := NewDevicePatch(d).Edit(func(d *Device) {
+		d.ThermostatExtModesConfig.Num1.Name = "Home"
+		d.Thermometers[0].Name = "Living room"
+	})
+
+	payload := p.Payload()
+	modes := payload["thermostat_ext_modes_config"].(map[string]interface{})
+	if len(modes) != 2 {
+		t.Errorf("modes = %v, want only reported modes 1 and 2", modes)
+	}
+	comfort := modes["1"].(map[string]interface{})
+	if comfort["name"] != "Home" {
+		t.Errorf("name = %v", comfort["name"])
+	}
+	if temp := comfort["zone_temp"].(map[string]interface{}); temp["2"] != 19.0 {
+		t.Errorf("zone 2 temp is dropped: %v", temp)
+	}
+	if sensors := comfort["zone_sensors"].(map[string]interface{}); sensors["2"] != "uuid-2" {
+		t.Errorf("zone 2 sensor is dropped: %v", sensors)
+	}
+
+	thermometer := payload["thermometers"].([]interface{})[0].(map[string]interface{})
+	if thermometer["name"] != "Living room" || thermometer["offset"] != -0.5 {
+		t.Errorf("thermometer = %v", thermometer)
+	}
+
+	changes := p.Diff()
+	if len(changes) != 2 || changes[0].Path != "thermometers" || changes[1].Path != "thermostat_ext_modes_config.1.name" {
+		t.Errorf("diff = %v", changes)
+	}
+}
+
+func TestPatchSetMerges(t *testing.T) {
+	d := testDevice(t, `{"id":7,"pump":{"overrun":120,"mode":"auto"}}`)
+	if p := NewDevicePatch(d).Set("pump", map[string]interface{}{"overrun": 120}); !p.Empty() {
+		t.Errorf("setting current value is change: %v", p.Payload())
+	}
+	p := NewDevicePatch(d).Set("pump", map[string]interface{}{"overrun": 60})
+	pump := p.Payload()["pump"].(map[string]interface{})
+	if pump["overrun"] != 60.0 || pump["mode"] != "auto" {
+		t.Errorf("pump = %v", pump)
+	}
+}
@@ -0,0 +1,442 @@
+package zont
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type CommandKind string
+
+const (
+	CommandTargetTemp CommandKind = "target_temp"
+	CommandExtMode    CommandKind = "ext_mode"
+	CommandGuard      CommandKind = "guard"
+	// CommandUpdate send Payload to UpdateDevice as is
+	CommandUpdate CommandKind = "update"
+)
+
+type CommandStatus string
+
+const (
+	CommandQueued     CommandStatus = "queued"
+	CommandSent       CommandStatus = "sent"
+	CommandApplied    CommandStatus = "applied"
+	CommandPending    CommandStatus = "pending"
+	CommandFailed     CommandStatus = "failed"
+	CommandExpired    CommandStatus = "expired"
+	CommandSuperseded CommandStatus = "superseded"
+)
+
+const (
+	defaultCommandTTL     = 24 * time.Hour
+	defaultReplayInterval = time.Minute
+)
+
+// Command is write held in CommandQueue
+type Command struct {
+	ID       string          `json:"id"`
+	DeviceID int             `json:"device_id"`
+	Kind     CommandKind     `json:"kind"`
+	Zone     string          `json:"zone,omitempty"`
+	Temp     Celsius         `json:"temp,omitempty"`
+	Mode     int             `json:"mode,omitempty"`
+	Guard    bool            `json:"guard,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Status   CommandStatus   `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Expires  time.Time       `json:"expires"`
+	Updated  time.Time       `json:"updated"`
+	// Sent is time of last send, pending command is checked against reports after it
+	Sent time.Time `json:"sent,omitempty"`
+}
+
+// supersedes return true when c make other command useless
+func (c *Command) supersedes(other *Command) bool {
+	if c.DeviceID != other.DeviceID || c.Kind != other.Kind {
+		return false
+	}
+	switch c.Kind {
+	case CommandTargetTemp:
+		return c.Zone == other.Zone
+	case CommandExtMode, CommandGuard:
+		return true
+	}
+	return false
+}
+
+// CommandQueue hold writes for offline controllers in JSON file and replay them
+// in order when controller is online again
+type CommandQueue struct {
+	client *Client
+	path   string
+	// TTL of queued commands, one day by default
+	TTL time.Duration
+	// Confirm is timeout of WithConfirm used on replay, zero send without confirmation
+	Confirm time.Duration
+
+	mu       sync.Mutex
+	commands []*Command
+}
+
+// OpenCommandQueue load queue from file path, file is created on first change
+func OpenCommandQueue(client *Client, path string) (*CommandQueue, error) {
+	q := &CommandQueue{client: client, path: path, TTL: defaultCommandTTL}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.commands); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// save must be called with mu locked
+func (q *CommandQueue) save() error {
+	data, err := json.MarshalIndent(q.commands, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
+
+func newCommandID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Enqueue add command to queue, queued and pending commands it supersede are marked superseded
+func (q *CommandQueue) Enqueue(cmd Command) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	cmd.ID = newCommandID()
+	cmd.Status = CommandQueued
+	cmd.Created = now
+	cmd.Updated = now
+	if cmd.Expires.IsZero() {
+		cmd.Expires = now.Add(q.TTL)
+	}
+
+	for _, c := range q.commands {
+		if (c.Status == CommandQueued || c.Status == CommandPending) && cmd.supersedes(c) {
+			c.Status = CommandSuperseded
+			c.Updated = now
+		}
+	}
+	q.commands = append(q.commands, &cmd)
+	return cmd.ID, q.save()
+}
+
+// SetTargetTemp queue zone setpoint change, setpoint is validated now
+func (q *CommandQueue) SetTargetTemp(deviceId int, zone string, temp float64) (string, error) {
+	value := NewCelsius(temp)
+	if q.client.validation != ValidateOff {
+		device, err := q.client.Device(deviceId)
+		if err != nil {
+			return "", err
+		}
+		if value, err = device.ValidateSetpoint(zone, value, q.client.validation); err != nil {
+			return "", err
+		}
+	}
+	return q.Enqueue(Command{DeviceID: deviceId, Kind: CommandTargetTemp, Zone: zone, Temp: value})
+}
+
+// SetExtMode queue extended mode switch
+func (q *CommandQueue) SetExtMode(deviceId int, mode int) (string, error) {
+	return q.Enqueue(Command{DeviceID: deviceId, Kind: CommandExtMode, Mode: mode})
+}
+
+// SetGuard queue guard arm or disarm
+func (q *CommandQueue) SetGuard(deviceId int, enable bool) (string, error) {
+	return q.Enqueue(Command{DeviceID: deviceId, Kind: CommandGuard, Guard: enable})
+}
+
+// UpdateDevice queue raw update_device payload
+func (q *CommandQueue) UpdateDevice(deviceId int, data interface{}) (string, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return q.Enqueue(Command{DeviceID: deviceId, Kind: CommandUpdate, Payload: payload})
+}
+
+// Status return command with id
+func (q *CommandQueue) Status(id string) (Command, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, c := range q.commands {
+		if c.ID == id {
+			return *c, true
+		}
+	}
+	return Command{}, false
+}
+
+// Commands return commands of device in order they were queued, all commands when deviceId is 0
+func (q *CommandQueue) Commands(deviceId int) []Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var commands []Command
+	for _, c := range q.commands {
+		if deviceId == 0 || c.DeviceID == deviceId {
+			commands = append(commands, *c)
+		}
+	}
+	return commands
+}
+
+// Prune remove finished commands older than age, queued and pending commands are kept
+func (q *CommandQueue) Prune(age time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limit := time.Now().Add(-age)
+	kept := q.commands[:0]
+	for _, c := range q.commands {
+		if c.Status == CommandQueued || c.Status == CommandPending || c.Updated.After(limit) {
+			kept = append(kept, c)
+		}
+	}
+	q.commands = kept
+	return q.save()
+}
+
+// Replay expire stale commands, send queued commands of online devices and check
+// pending commands until controller apply them or they expire.
+// With client in dry run commands are only logged and queue is not changed.
+func (q *CommandQueue) Replay() error {
+	return q.ReplayContext(context.Background())
+}
+
+// ReplayContext is Replay which stop sending and waiting for confirmation when
+// ctx is done
+func (q *CommandQueue) ReplayContext(ctx context.Context) error {
+	dryRun := q.client.DryRun()
+
+	q.mu.Lock()
+	now := time.Now()
+	devices := map[int][]*Command{}
+	var pending []*Command
+	for _, c := range q.commands {
+		if c.Status == CommandPending && !dryRun {
+			pending = append(pending, c)
+			continue
+		}
+		if c.Status != CommandQueued {
+			continue
+		}
+		if now.After(c.Expires) {
+			if !dryRun {
+				c.Status = CommandExpired
+				c.Updated = now
+			}
+			continue
+		}
+		devices[c.DeviceID] = append(devices[c.DeviceID], c)
+	}
+	var err error
+	if !dryRun {
+		err = q.save()
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(devices))
+	for id := range devices {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	q.client.InvalidateDevices()
+	if err := q.recheck(pending); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		device, err := q.client.Device(id)
+		if err != nil {
+			ContextLogger.Error(err)
+			continue
+		}
+		if !device.Online {
+			continue
+		}
+		for _, c := range devices[id] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sent := time.Now()
+			status, sendErr := q.send(ctx, c)
+			if dryRun {
+				ContextLogger.Infoln("dry run, command", c.ID, "is kept queued")
+				continue
+			}
+
+			q.mu.Lock()
+			c.Status = status
+			c.Error = ""
+			if sendErr != nil {
+				c.Error = sendErr.Error()
+			}
+			if status != CommandFailed {
+				c.Sent = sent
+			}
+			c.Updated = time.Now()
+			err := q.save()
+			q.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recheck update pending commands from last device reports, command is applied
+// when controller reported its value and expired or failed after Expires
+func (q *CommandQueue) recheck(pending []*Command) error {
+	for _, c := range pending {
+		check := q.check(c)
+		if check == nil {
+			continue
+		}
+		device, err := q.client.Device(c.DeviceID)
+		if err != nil {
+			ContextLogger.Error(err)
+			continue
+		}
+
+		status := CommandPending
+		err = checkApplied(device, c.Sent, check)
+		switch {
+		case err == nil:
+			status = CommandApplied
+		case time.Now().After(c.Expires) && errors.Is(err, ErrWriteNotApplied):
+			status = CommandFailed
+		case time.Now().After(c.Expires):
+			status = CommandExpired
+		}
+		if status == CommandPending {
+			continue
+		}
+
+		q.mu.Lock()
+		c.Status = status
+		c.Error = ""
+		if err != nil {
+			c.Error = err.Error()
+		}
+		c.Updated = time.Now()
+		err = q.save()
+		q.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check return confirmCheck of command, nil when command can not be checked
+func (q *CommandQueue) check(c *Command) confirmCheck {
+	switch c.Kind {
+	case CommandTargetTemp:
+		return q.client.zoneTargetApplied(c.Zone, c.Temp, c.Sent)
+	case CommandExtMode:
+		return func(d *Device) bool { return d.ThermostatExtMode == c.Mode }
+	case CommandGuard:
+		return func(d *Device) bool { return d.ThermostatEnableGuard == c.Guard }
+	}
+	return nil
+}
+
+func (q *CommandQueue) send(ctx context.Context, c *Command) (CommandStatus, error) {
+	// setpoint was validated when queued
+	var result WriteResult
+	opts := []WriteOption{WithValidation(ValidateOff), WithCorrelationID(c.ID), WithContext(ctx), WithResult(&result)}
+	if c.Kind == CommandUpdate {
+		// payload can not be confirmed
+		err := q.client.UpdateDevice(c.Payload, opts...)
+		if err != nil {
+			return CommandFailed, err
+		}
+		return CommandSent, nil
+	}
+	if q.Confirm > 0 {
+		opts = append(opts, WithConfirm(q.Confirm))
+	}
+
+	var err error
+	switch c.Kind {
+	case CommandTargetTemp:
+		err = q.client.SetTargetTemp(c.DeviceID, c.Zone, c.Temp.Float64(), opts...)
+	case CommandExtMode:
+		err = q.client.SetExtMode(c.DeviceID, c.Mode, opts...)
+	case CommandGuard:
+		err = q.client.SetGuard(c.DeviceID, c.Guard, opts...)
+	default:
+		return CommandFailed, fmt.Errorf("unknown command kind %q", c.Kind)
+	}
+
+	if err != nil {
+		if WriteStatusOf(err) == WritePending {
+			return CommandPending, err
+		}
+		return CommandFailed, err
+	}
+	if result.Status == WriteApplied {
+		return CommandApplied, nil
+	}
+	return CommandSent, nil
+}
+
+// Run replay queue every interval (one minute when not set) until ctx is done
+func (q *CommandQueue) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultReplayInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := q.ReplayContext(ctx); err != nil && ctx.Err() == nil {
+			ContextLogger.Error(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package zont
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// devicesHandler answer devices request with body and count update_device calls
+func devicesHandler(t *testing.T, devices string, updates *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			w.Write([]byte(devices))
+		case strings.HasSuffix(r.URL.Path, "/update_device"):
+			*updates++
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+}
+
+func TestReplayDryRunKeepsQueue(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[{"id":7,"online":true}]}`, &updates))
+	cl.SetDryRun(true)
+
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenCommandQueue(cl, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := q.SetExtMode(7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Replay(); err != nil {
+		t.Fatal(err)
+	}
+
+	if updates != 0 {
+		t.Errorf("dry run sent %d update_device requests", updates)
+	}
+	if c, _ := q.Status(id); c.Status != CommandQueued {
+		t.Errorf("status %s, want %s", c.Status, CommandQueued)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("dry run changed queue file")
+	}
+
+	cl.SetDryRun(false)
+	if err := q.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if updates != 1 {
+		t.Errorf("sent %d update_device requests, want 1", updates)
+	}
+	if c, _ := q.Status(id); c.Status != CommandSent {
+		t.Errorf("status %s, want %s", c.Status, CommandSent)
+	}
+}
+
+func TestReplayRechecksPending(t *testing.T) {
+	var device atomic.Value
+	device.Store(`{"ok":true,"devices":[{"id":7,"online":true,"thermostat_ext_mode":1}]}`)
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			w.Write([]byte(device.Load().(string)))
+		case strings.HasSuffix(r.URL.Path, "/update_device"):
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+
+	q, err := OpenCommandQueue(cl, filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// controller does not report within confirm timeout
+	q.Confirm = 50 * time.Millisecond
+	applied, err := q.SetExtMode(7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := q.SetGuard(7, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{applied, expiring} {
+		if c, _ := q.Status(id); c.Status != CommandPending || c.Sent.IsZero() {
+			t.Fatalf("status %s sent %v, want pending", c.Status, c.Sent)
+		}
+	}
+
+	// controller reported mode but not guard, guard command expires
+	q.mu.Lock()
+	for _, c := range q.commands {
+		if c.ID == expiring {
+			c.Expires = time.Now().Add(-time.Second)
+		}
+	}
+	q.mu.Unlock()
+	device.Store(fmt.Sprintf(`{"ok":true,"devices":[{"id":7,"online":true,"thermostat_ext_mode":2,"last_receive_time":%d}]}`,
+		time.Now().Add(time.Minute).Unix()))
+
+	if err := q.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := q.Status(applied); c.Status != CommandApplied {
+		t.Errorf("mode command %s, want %s", c.Status, CommandApplied)
+	}
+	if c, _ := q.Status(expiring); c.Status != CommandFailed || c.Error == "" {
+		t.Errorf("guard command %s %q, want %s", c.Status, c.Error, CommandFailed)
+	}
+}
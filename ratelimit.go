@@ -0,0 +1,195 @@
+package zont
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// RateStats is counters of requests sent to ZONT API
+type RateStats struct {
+	// Calls is API method calls
+	Calls int64
+	// Requests is HTTP requests including retries
+	Requests int64
+	// Throttled is count of 429 responses
+	Throttled int64
+	// Waited is total time spent waiting for limiter
+	Waited time.Duration
+	// Rate and Burst of limiter, zero Rate means no limit
+	Rate  float64
+	Burst int
+	// Tokens is requests available right now without waiting
+	Tokens float64
+	// PausedUntil is set when server asked to retry later
+	PausedUntil time.Time
+}
+
+// rateLimiter is token bucket shared by all requests of Client
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       int
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	stats       RateStats
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{last: time.Now()}
+}
+
+func (l *rateLimiter) setRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	l.rate = rate
+	l.burst = burst
+	l.tokens = float64(burst)
+	l.last = time.Now()
+}
+
+// refill must be called with mu locked
+func (l *rateLimiter) refill(now time.Time) {
+	if l.rate <= 0 {
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+}
+
+// wait block until request can be sent or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	start := time.Now()
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var delay time.Duration
+		if now.Before(l.pausedUntil) {
+			delay = l.pausedUntil.Sub(now)
+		} else if l.rate > 0 {
+			l.refill(now)
+			if l.tokens >= 1 {
+				l.tokens--
+			} else {
+				delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+			}
+		}
+		if delay == 0 {
+			l.stats.Requests++
+			l.stats.Waited += now.Sub(start)
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// throttled pause all requests until server allow them again
+func (l *rateLimiter) throttled(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Throttled++
+	if until := time.Now().Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *rateLimiter) call() {
+	l.mu.Lock()
+	l.stats.Calls++
+	l.mu.Unlock()
+}
+
+func (l *rateLimiter) snapshot() RateStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	s := l.stats
+	s.Rate = l.rate
+	s.Burst = l.burst
+	s.Tokens = l.tokens
+	s.PausedUntil = l.pausedUntil
+	return s
+}
+
+// limitedTransport apply rate limiter to every HTTP attempt made by retryablehttp
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		retryAfter, ok := parseRetryAfter(resp)
+		if resp.StatusCode == http.StatusTooManyRequests || ok {
+			if !ok {
+				retryAfter = time.Second
+			}
+			t.limiter.throttled(retryAfter)
+		}
+	}
+	return resp, err
+}
+
+// parseRetryAfter read Retry-After header in seconds or HTTP date form
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// retryAfterBackoff is retryablehttp.DefaultBackoff with support of HTTP date in Retry-After,
+// wait is never longer than max
+func retryAfterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if retryAfter, ok := parseRetryAfter(resp); ok && retryAfter > 0 {
+			if retryAfter > max {
+				return max
+			}
+			return retryAfter
+		}
+	}
+	return retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+}
+
+// SetRateLimit limit requests to ZONT API to rate per second with burst,
+// retries of retryablehttp are counted too. Zero rate disable limit.
+func (cl *Client) SetRateLimit(rate float64, burst int) {
+	cl.limiter.setRate(rate, burst)
+}
+
+// RateStats return request counters and current limiter state
+func (cl *Client) RateStats() RateStats {
+	return cl.limiter.snapshot()
+}
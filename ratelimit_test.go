@@ -0,0 +1,147 @@
+package zont
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLimitedTestClient return test client which sends requests through limitedTransport
+// without retries of retryablehttp
+func newLimitedTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := NewClient("test", "test", "login", "password")
+	cl.httpClient = &http.Client{Transport: &limitedTransport{rewriteTransport{target}, cl.limiter}}
+	cl.AuthTokenResponse = &AuthTokenResponse{Token: "token", Ok: true}
+	return cl
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	cl := newLimitedTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"devices":[]}`))
+	}))
+	cl.SetRateLimit(20, 2)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		cl.GetDevices()
+	}
+	elapsed := time.Since(start)
+
+	// burst is sent at once, other 4 requests wait 50ms each
+	if elapsed < 180*time.Millisecond {
+		t.Errorf("6 requests took %s, want at least 200ms", elapsed)
+	}
+	stats := cl.RateStats()
+	if stats.Calls != 6 || stats.Requests != 6 {
+		t.Errorf("got %d calls %d requests, want 6 and 6", stats.Calls, stats.Requests)
+	}
+	if stats.Waited < 150*time.Millisecond {
+		t.Errorf("waited %s, want about 200ms", stats.Waited)
+	}
+	if stats.Rate != 20 || stats.Burst != 2 {
+		t.Errorf("got rate %v burst %d, want 20 and 2", stats.Rate, stats.Burst)
+	}
+	if stats.Tokens > 1 {
+		t.Errorf("got %.2f tokens right after burst", stats.Tokens)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	var requests int32
+	cl := newLimitedTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"ok":true,"devices":[]}`))
+	}))
+	cl.SetRateLimit(0, 0)
+
+	start := time.Now()
+	cl.GetDevices()
+	stats := cl.RateStats()
+	if stats.Throttled != 1 {
+		t.Errorf("got %d throttled, want 1", stats.Throttled)
+	}
+	if pause := stats.PausedUntil.Sub(start); pause < 900*time.Millisecond || pause > 2*time.Second {
+		t.Errorf("paused for %s, want 1s", pause)
+	}
+
+	// unlimited client still waits for pause asked by server
+	cl.GetDevices()
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("second request sent after %s, want after pause of 1s", elapsed)
+	}
+	stats = cl.RateStats()
+	if stats.Requests != 2 || stats.Throttled != 1 {
+		t.Errorf("got %d requests %d throttled, want 2 and 1", stats.Requests, stats.Throttled)
+	}
+}
+
+func TestRetryAfterBackoff(t *testing.T) {
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+	min, max := time.Second, 30*time.Second
+
+	tests := []struct {
+		name string
+		resp *http.Response
+		want time.Duration
+	}{
+		{"seconds", response(http.StatusTooManyRequests, "5"), 5 * time.Second},
+		{"unavailable", response(http.StatusServiceUnavailable, "7"), 7 * time.Second},
+		{"capped", response(http.StatusTooManyRequests, "3600"), max},
+		{"date capped", response(http.StatusTooManyRequests, time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)), max},
+		{"no header", response(http.StatusTooManyRequests, ""), 2 * time.Second},
+		{"other status", response(http.StatusInternalServerError, "5"), 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryAfterBackoff(min, max, 1, tt.resp); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitRetriedRequests(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"ok":true,"devices":[{"id":7}]}`))
+	}))
+	defer srv.Close()
+
+	// client of NewClient retries 429 through limiter
+	cl := NewClient("test", "test", "login", "password")
+	cl.SetBaseURL(srv.URL + "/")
+	cl.AuthTokenResponse = &AuthTokenResponse{Token: "token", Ok: true}
+
+	devices := cl.GetDevices()
+	if devices == nil || len(devices.Devices) != 1 {
+		t.Fatalf("got %+v, want devices after retry", devices)
+	}
+	stats := cl.RateStats()
+	if stats.Calls != 1 || stats.Requests != 2 || stats.Throttled != 1 {
+		t.Errorf("got %d calls %d requests %d throttled, want 1, 2 and 1", stats.Calls, stats.Requests, stats.Throttled)
+	}
+}
@@ -0,0 +1,304 @@
+package zont
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultApplyConcurrency = 4
+
+// DesiredState is target configuration of devices, usually read from YAML:
+//
+//	devices:
+//	  - serial: "0123456789"
+//	    mode: Comfort
+//	    setpoints:
+//	      "1": 21.5
+//	    notifications:
+//	      guard:
+//	        numbers: "+79001234567"
+//	    settings:
+//	      thermostat_hysteresis: 0.5
+type DesiredState struct {
+	Devices []DesiredDevice `json:"devices" yaml:"devices"`
+}
+
+// DesiredDevice is target configuration of one device, device is found by ID,
+// Serial or Name. Empty fields are not managed.
+type DesiredDevice struct {
+	ID     int    `json:"id,omitempty" yaml:"id,omitempty"`
+	Serial string `json:"serial,omitempty" yaml:"serial,omitempty"`
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Mode is name of extended mode from ThermostatExtModesConfig
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Setpoints is target temperature by zone
+	Setpoints map[string]float64 `json:"setpoints,omitempty" yaml:"setpoints,omitempty"`
+	// Schedule is tempschedule of device
+	Schedule map[string]interface{} `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	// Notifications is notifications of device
+	Notifications map[string]interface{} `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+	// Settings is any other update_device fields
+	Settings map[string]interface{} `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+func (dd *DesiredDevice) String() string {
+	switch {
+	case dd.ID != 0:
+		return fmt.Sprint(dd.ID)
+	case dd.Serial != "":
+		return "serial " + dd.Serial
+	}
+	return dd.Name
+}
+
+func (dd *DesiredDevice) matches(d *Device) bool {
+	switch {
+	case dd.ID != 0:
+		return dd.ID == d.ID
+	case dd.Serial != "":
+		return dd.Serial == d.Serial
+	}
+	return dd.Name != "" && dd.Name == d.Name
+}
+
+// LoadDesiredState read desired state from YAML or JSON file
+func LoadDesiredState(path string) (*DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &DesiredState{}
+	if err := yaml.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// PlanItem is drift of one device
+type PlanItem struct {
+	Desired  DesiredDevice
+	DeviceID int
+	Patch    *DevicePatch
+	// Unmodelled is settings which Device does not have, they are compared with
+	// JSON of device but their values are not checked
+	Unmodelled []string
+	Err        error
+}
+
+// Plan is changes needed to reach desired state
+type Plan []PlanItem
+
+// String return human readable plan
+func (p Plan) String() string {
+	var b strings.Builder
+	for _, item := range p {
+		switch {
+		case item.Err != nil:
+			fmt.Fprintf(&b, "%s: error: %v\n", item.Desired.String(), item.Err)
+		default:
+			b.WriteString(item.Patch.String())
+			payload := item.Patch.Payload()
+			for _, field := range item.Unmodelled {
+				if _, ok := payload[field]; ok {
+					fmt.Fprintf(&b, "  %s: not modelled by Device, value is not checked\n", field)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// Changes return count of devices with changes
+func (p Plan) Changes() int {
+	count := 0
+	for _, item := range p {
+		if item.Err == nil && !item.Patch.Empty() {
+			count++
+		}
+	}
+	return count
+}
+
+// deviceFields return json names of top level Device fields
+func deviceFields() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(Device{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// overlay write json of values into d, only given fields are changed. Top level
+// fields which Device does not have are returned to be sent with DevicePatch.Set,
+// unknown nested field is error, it would be silently dropped otherwise.
+func overlay(d *Device, values map[string]interface{}) (unmodelled map[string]interface{}, err error) {
+	fields := deviceFields()
+	known := map[string]interface{}{}
+	unmodelled = map[string]interface{}{}
+	for key, value := range values {
+		if fields[key] {
+			known[key] = value
+		} else {
+			unmodelled[key] = value
+		}
+	}
+
+	data, err := json.Marshal(known)
+	if err != nil {
+		return nil, err
+	}
+	// decode without Device.UnmarshalJSON, it does not report unknown fields
+	type device Device
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return unmodelled, dec.Decode((*device)(d))
+}
+
+// desiredPatch return patch from device to desired configuration and names of
+// settings which Device does not have
+func desiredPatch(d *Device, dd *DesiredDevice) (*DevicePatch, []string, error) {
+	p := NewDevicePatch(d)
+	target := &p.Device
+
+	if dd.Mode != "" {
+		found := false
+		for i, name := range target.ExtModeNames() {
+			if name == dd.Mode {
+				target.ThermostatExtMode = i
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("device %d has no mode %q", d.ID, dd.Mode)
+		}
+	}
+
+	if len(dd.Setpoints) > 0 {
+		temps := map[string]ThermostatTargetTemps{}
+		if target.ThermostatTargetTemps != nil {
+			for zone, t := range *target.ThermostatTargetTemps {
+				temps[zone] = t
+			}
+		}
+		for zone, value := range dd.Setpoints {
+			temp, err := target.ValidateSetpoint(zone, NewCelsius(value), ValidateStrict)
+			if err != nil {
+				return nil, nil, err
+			}
+			if current, ok := temps[zone]; ok && current.Temp == temp {
+				continue
+			}
+			temps[zone] = ThermostatTargetTemps{Manual: true, Temp: temp}
+		}
+		target.ThermostatTargetTemps = &temps
+	}
+
+	overlays := []map[string]interface{}{dd.Settings}
+	if dd.Schedule != nil {
+		overlays = append(overlays, map[string]interface{}{"tempschedule": dd.Schedule})
+	}
+	if dd.Notifications != nil {
+		overlays = append(overlays, map[string]interface{}{"notifications": dd.Notifications})
+	}
+	var unmodelled []string
+	for _, values := range overlays {
+		if len(values) == 0 {
+			continue
+		}
+		raw, err := overlay(target, values)
+		if err != nil {
+			return nil, nil, fmt.Errorf("device %d: %w", d.ID, err)
+		}
+		for field, value := range raw {
+			p.Set(field, value)
+			unmodelled = append(unmodelled, field)
+		}
+	}
+	sort.Strings(unmodelled)
+	return p, unmodelled, nil
+}
+
+// Plan compare desired state with current devices and return drift of every device
+func (cl *Client) Plan(state *DesiredState) (Plan, error) {
+	if cl.AuthTokenResponse == nil || len(cl.AuthTokenResponse.Token) < 1 {
+		return nil, fmt.Errorf("AuthToken not exist")
+	}
+	resp := cl.GetDevices()
+	if resp == nil || !resp.Ok {
+		return nil, fmt.Errorf("devices request failed")
+	}
+
+	plan := make(Plan, 0, len(state.Devices))
+	for _, dd := range state.Devices {
+		item := PlanItem{Desired: dd}
+		var device *Device
+		for i := range resp.Devices {
+			if dd.matches(&resp.Devices[i]) {
+				device = &resp.Devices[i]
+				break
+			}
+		}
+		if device == nil {
+			item.Err = fmt.Errorf("device %s not found", dd.String())
+		} else {
+			item.DeviceID = device.ID
+			item.Patch, item.Unmodelled, item.Err = desiredPatch(device, &dd)
+		}
+		plan = append(plan, item)
+	}
+	return plan, nil
+}
+
+// ApplyResult is result of applying plan to one device
+type ApplyResult struct {
+	DeviceID int
+	Changes  []FieldChange
+	Err      error
+}
+
+// Apply send changes of plan with at most concurrency parallel writes. Devices
+// without changes and with plan errors are not written.
+func (cl *Client) Apply(ctx context.Context, plan Plan, concurrency int) []ApplyResult {
+	if concurrency < 1 {
+		concurrency = defaultApplyConcurrency
+	}
+
+	results := make([]ApplyResult, len(plan))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range plan {
+		results[i] = ApplyResult{DeviceID: item.DeviceID, Err: item.Err}
+		if item.Err != nil || item.Patch.Empty() {
+			continue
+		}
+		results[i].Changes = item.Patch.Diff()
+
+		wg.Add(1)
+		go func(i int, p *DevicePatch) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i].Err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			results[i].Err = cl.ApplyPatch(p)
+		}(i, item.Patch)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,103 @@
+package zont
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDesiredPatchUnmodelled(t *testing.T) {
+	d := testDevice(t, `{"id":7,"name":"Boiler room","thermostat_hysteresis":1}`)
+	dd := DesiredDevice{
+		ID: 7,
+		Settings: map[string]interface{}{
+			"thermostat_hysteresis": 0.5,
+			"pump_overrun":          120,
+		},
+	}
+
+	p, unmodelled, err := desiredPatch(d, &dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(unmodelled, ",") != "pump_overrun" {
+		t.Errorf("unmodelled = %v", unmodelled)
+	}
+	payload := p.Payload()
+	if payload["pump_overrun"] != 120.0 {
+		t.Errorf("pump_overrun = %v, want 120", payload["pump_overrun"])
+	}
+	if payload["thermostat_hysteresis"] != 0.5 {
+		t.Errorf("thermostat_hysteresis = %v, want 0.5", payload["thermostat_hysteresis"])
+	}
+
+	plan := Plan{{Desired: dd, DeviceID: 7, Patch: p, Unmodelled: unmodelled}}
+	if !strings.Contains(plan.String(), "pump_overrun: not modelled by Device, value is not checked") {
+		t.Errorf("plan does not report unmodelled field:\n%s", plan)
+	}
+	if plan.Changes() != 1 {
+		t.Errorf("plan changes = %d, want 1", plan.Changes())
+	}
+}
+
+func TestDesiredPatchUnmodelledInSync(t *testing.T) {
+	d := testDevice(t, `{"id":7,"thermostat_hysteresis":0.5,"pump_overrun":120,"pump":{"mode":"auto","delay":30}}`)
+	dd := DesiredDevice{
+		ID: 7,
+		Settings: map[string]interface{}{
+			"thermostat_hysteresis": 0.5,
+			"pump_overrun":          120,
+			"pump":                  map[string]interface{}{"mode": "auto"},
+		},
+	}
+
+	p, unmodelled, err := desiredPatch(d, &dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unmodelled) != 2 {
+		t.Errorf("unmodelled = %v", unmodelled)
+	}
+	if !p.Empty() {
+		t.Errorf("device in desired state has changes: %v", p.Payload())
+	}
+	plan := Plan{{Desired: dd, DeviceID: 7, Patch: p, Unmodelled: unmodelled}}
+	if plan.Changes() != 0 || strings.Contains(plan.String(), "not modelled") {
+		t.Errorf("plan of device in desired state:\n%s", plan)
+	}
+
+	dd.Settings["pump"] = map[string]interface{}{"mode": "manual"}
+	p, _, err = desiredPatch(d, &dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := p.Diff()
+	if len(changes) != 1 || changes[0].Path != "pump.mode" || changes[0].Old != "auto" {
+		t.Errorf("diff = %v", changes)
+	}
+	if pump := p.Payload()["pump"].(map[string]interface{}); pump["delay"] != 30.0 {
+		t.Errorf("pump = %v, want delay kept", pump)
+	}
+}
+
+func TestDesiredPatchUnknownNestedField(t *testing.T) {
+	d := testDevice(t, `{"id":7}`)
+	tests := []DesiredDevice{
+		{ID: 7, Notifications: map[string]interface{}{"guard": map[string]interface{}{"numbrs": "+79001234567"}}},
+		{ID: 7, Notifications: map[string]interface{}{"gaurd": map[string]interface{}{"numbers": "+79001234567"}}},
+		{ID: 7, Schedule: map[string]interface{}{"weak": map[string]interface{}{}}},
+	}
+	for _, dd := range tests {
+		if _, _, err := desiredPatch(d, &dd); err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Errorf("%v: err = %v, want unknown field", dd, err)
+		}
+	}
+
+	dd := DesiredDevice{ID: 7, Notifications: map[string]interface{}{"guard": map[string]interface{}{"numbers": "+79001234567"}}}
+	p, _, err := desiredPatch(d, &dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Device.Notifications.Guard.Numbers != "+79001234567" {
+		t.Errorf("guard numbers = %q", p.Device.Notifications.Guard.Numbers)
+	}
+}
@@ -0,0 +1,217 @@
+package zont
+
+import (
+	"math"
+	"time"
+)
+
+type Aggregation string
+
+const (
+	AggMin  Aggregation = "min"
+	AggMax  Aggregation = "max"
+	AggMean Aggregation = "mean"
+	AggLast Aggregation = "last"
+	AggSum  Aggregation = "sum"
+	// AggTimeWeighted is average where every sample hold its value until next sample
+	AggTimeWeighted Aggregation = "time_weighted"
+)
+
+type GapFill string
+
+const (
+	// GapFlag keep gap buckets with NaN value
+	GapFlag GapFill = "flag"
+	// GapPrevious use value of previous bucket
+	GapPrevious GapFill = "previous"
+	// GapLinear interpolate between neighbour buckets
+	GapLinear GapFill = "linear"
+)
+
+// Bucket is aggregated value of samples with time in [Start, Start+step)
+type Bucket struct {
+	Start int64
+	Value float64
+	Count int
+	// Gap is true when bucket has no samples
+	Gap bool
+	// Filled is true when Value of gap bucket was filled by FillGaps
+	Filled bool
+}
+
+type Buckets []Bucket
+
+// Resample aggregate samples into buckets of step from start to end.
+// Series must be ordered by time. Buckets without samples have Gap set and NaN value.
+func (s Series) Resample(start, end time.Time, step time.Duration, agg Aggregation) Buckets {
+	stepSec := int64(step / time.Second)
+	if stepSec < 1 || !end.After(start) {
+		return nil
+	}
+	from, to := start.Unix(), end.Unix()
+
+	count := int((to - from + stepSec - 1) / stepSec)
+	buckets := make(Buckets, count)
+	for i := range buckets {
+		buckets[i] = Bucket{Start: from + int64(i)*stepSec, Value: math.NaN(), Gap: true}
+	}
+
+	// previous is last sample before current bucket, used by time weighted average
+	previous := -1
+	i := 0
+	for i < len(s) && s[i].Time < from {
+		previous = i
+		i++
+	}
+
+	for b := range buckets {
+		bucketEnd := buckets[b].Start + stepSec
+		if bucketEnd > to {
+			bucketEnd = to
+		}
+		first := i
+		for i < len(s) && s[i].Time < bucketEnd {
+			i++
+		}
+		samples := s[first:i]
+		if len(samples) > 0 {
+			buckets[b].Count = len(samples)
+			buckets[b].Gap = false
+			buckets[b].Value = aggregate(samples, agg, s, previous, buckets[b].Start, bucketEnd)
+			previous = i - 1
+		}
+	}
+	return buckets
+}
+
+func aggregate(samples Series, agg Aggregation, all Series, previous int, start, end int64) float64 {
+	switch agg {
+	case AggMin:
+		v := samples[0].Value
+		for _, s := range samples[1:] {
+			v = math.Min(v, s.Value)
+		}
+		return v
+	case AggMax:
+		v := samples[0].Value
+		for _, s := range samples[1:] {
+			v = math.Max(v, s.Value)
+		}
+		return v
+	case AggLast:
+		return samples[len(samples)-1].Value
+	case AggSum:
+		var sum float64
+		for _, s := range samples {
+			sum += s.Value
+		}
+		return sum
+	case AggTimeWeighted:
+		return timeWeighted(samples, all, previous, start, end)
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s.Value
+	}
+	return sum / float64(len(samples))
+}
+
+// timeWeighted return average of step function made by samples on [start, end)
+func timeWeighted(samples Series, all Series, previous int, start, end int64) float64 {
+	var weighted float64
+	var total int64
+
+	if previous >= 0 {
+		// value of previous sample is held from bucket start
+		d := samples[0].Time - start
+		weighted += all[previous].Value * float64(d)
+		total += d
+	}
+	for i, s := range samples {
+		next := end
+		if i+1 < len(samples) {
+			next = samples[i+1].Time
+		}
+		d := next - s.Time
+		weighted += s.Value * float64(d)
+		total += d
+	}
+
+	if total == 0 {
+		return samples[len(samples)-1].Value
+	}
+	return weighted / float64(total)
+}
+
+// FillGaps fill runs of gap buckets not longer than maxGap buckets (any length when
+// maxGap is 0). GapLinear use GapPrevious for gaps at the end of buckets.
+func (b Buckets) FillGaps(fill GapFill, maxGap int) Buckets {
+	if fill == GapFlag {
+		return b
+	}
+	filled := make(Buckets, len(b))
+	copy(filled, b)
+
+	for i := 0; i < len(filled); {
+		if !filled[i].Gap {
+			i++
+			continue
+		}
+		j := i
+		for j < len(filled) && filled[j].Gap {
+			j++
+		}
+		// gap run is [i, j)
+		if i > 0 && (maxGap == 0 || j-i <= maxGap) {
+			before := filled[i-1].Value
+			for k := i; k < j; k++ {
+				v := before
+				if fill == GapLinear && j < len(filled) {
+					after := filled[j].Value
+					v = before + (after-before)*float64(k-i+1)/float64(j-i+1)
+				}
+				filled[k].Value = v
+				filled[k].Filled = true
+			}
+		}
+		i = j
+	}
+	return filled
+}
+
+// Series convert buckets to series with bucket start as time, gap buckets
+// without filled value are skipped
+func (b Buckets) Series() Series {
+	series := make(Series, 0, len(b))
+	for _, bucket := range b {
+		if bucket.Gap && !bucket.Filled {
+			continue
+		}
+		series = append(series, Sample{Time: bucket.Start, Value: bucket.Value})
+	}
+	return series
+}
+
+// Gaps return start of every bucket without samples
+func (b Buckets) Gaps() []int64 {
+	var gaps []int64
+	for _, bucket := range b {
+		if bucket.Gap {
+			gaps = append(gaps, bucket.Start)
+		}
+	}
+	return gaps
+}
+
+// ResampleDays aggregate samples into days of loc from day of start up to end.
+// Unlike Resample with 24 hour step buckets follow local midnight.
+func (s Series) ResampleDays(start, end time.Time, loc *time.Location, agg Aggregation) Buckets {
+	var buckets Buckets
+	for day := dayStart(start.Unix(), loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		b := s.Resample(day, next, next.Sub(day), agg)
+		buckets = append(buckets, b...)
+	}
+	return buckets
+}
@@ -0,0 +1,194 @@
+package zont
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResample(t *testing.T) {
+	t0 := int64(1699999200)
+	start, end := time.Unix(t0, 0), time.Unix(t0+3*3600, 0)
+	s := Series{{t0, 10}, {t0 + 600, 20}, {t0 + 1800, 30}, {t0 + 2*3600 + 300, 40}}
+
+	tests := []struct {
+		agg  Aggregation
+		want []float64
+	}{
+		{AggMin, []float64{10, math.NaN(), 40}},
+		{AggMax, []float64{30, math.NaN(), 40}},
+		{AggMean, []float64{20, math.NaN(), 40}},
+		{AggLast, []float64{30, math.NaN(), 40}},
+		{AggSum, []float64{60, math.NaN(), 40}},
+		// 30 is held from bucket start until 40
+		{AggTimeWeighted, []float64{(10*600 + 20*1200 + 30*1800) / 3600.0, math.NaN(), (30*300 + 40*3300) / 3600.0}},
+	}
+	for _, tt := range tests {
+		buckets := s.Resample(start, end, time.Hour, tt.agg)
+		if len(buckets) != len(tt.want) {
+			t.Errorf("%s: got %d buckets, want %d", tt.agg, len(buckets), len(tt.want))
+			continue
+		}
+		for i, b := range buckets {
+			if b.Start != t0+int64(i)*3600 {
+				t.Errorf("%s: bucket %d start %d", tt.agg, i, b.Start)
+			}
+			if math.IsNaN(tt.want[i]) {
+				if !b.Gap || !math.IsNaN(b.Value) || b.Count != 0 {
+					t.Errorf("%s: bucket %d = %+v, want gap", tt.agg, i, b)
+				}
+				continue
+			}
+			if b.Gap || math.Abs(b.Value-tt.want[i]) > 1e-9 {
+				t.Errorf("%s: bucket %d = %+v, want %v", tt.agg, i, b, tt.want[i])
+			}
+		}
+	}
+
+	counts := []int{}
+	for _, b := range s.Resample(start, end, time.Hour, AggMean) {
+		counts = append(counts, b.Count)
+	}
+	if !reflect.DeepEqual(counts, []int{3, 0, 1}) {
+		t.Errorf("counts %v, want [3 0 1]", counts)
+	}
+}
+
+func TestResampleTimeWeightedBeforeStart(t *testing.T) {
+	t0 := int64(1699999200)
+	// 5 is held from start until 15
+	s := Series{{t0 - 600, 5}, {t0 + 1800, 15}}
+	buckets := s.Resample(time.Unix(t0, 0), time.Unix(t0+3600, 0), time.Hour, AggTimeWeighted)
+	if len(buckets) != 1 || buckets[0].Value != 10 || buckets[0].Count != 1 {
+		t.Errorf("got %+v, want value 10 of 1 sample", buckets)
+	}
+}
+
+func TestResamplePartialLastBucket(t *testing.T) {
+	t0 := int64(1699999200)
+	s := Series{{t0 + 3600, 1}, {t0 + 5000, 2}, {t0 + 5400, 3}}
+	buckets := s.Resample(time.Unix(t0, 0), time.Unix(t0+5400, 0), time.Hour, AggTimeWeighted)
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+	// sample at end is not included, last bucket is 1800s long
+	if want := (1*1400 + 2*400) / 1800.0; buckets[1].Count != 2 || math.Abs(buckets[1].Value-want) > 1e-9 {
+		t.Errorf("last bucket %+v, want %v of 2 samples", buckets[1], want)
+	}
+}
+
+func TestResampleInvalidRange(t *testing.T) {
+	s := Series{{1700000000, 1}}
+	at := time.Unix(1700000000, 0)
+	if b := s.Resample(at, at, time.Hour, AggMean); b != nil {
+		t.Errorf("empty range: got %+v", b)
+	}
+	if b := s.Resample(at, at.Add(time.Hour), time.Millisecond, AggMean); b != nil {
+		t.Errorf("step below second: got %+v", b)
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	nan := math.NaN()
+	buckets := func(values ...float64) Buckets {
+		b := make(Buckets, len(values))
+		for i, v := range values {
+			b[i] = Bucket{Start: int64(i) * 60, Value: v, Count: 1}
+			if math.IsNaN(v) {
+				b[i].Count, b[i].Gap = 0, true
+			}
+		}
+		return b
+	}
+	in := buckets(nan, 1, nan, nan, 4, nan)
+
+	tests := []struct {
+		name   string
+		fill   GapFill
+		maxGap int
+		want   []float64
+	}{
+		{"flag", GapFlag, 0, []float64{nan, 1, nan, nan, 4, nan}},
+		{"previous", GapPrevious, 0, []float64{nan, 1, 1, 1, 4, 4}},
+		{"linear", GapLinear, 0, []float64{nan, 1, 2, 3, 4, 4}},
+		{"max gap", GapLinear, 1, []float64{nan, 1, nan, nan, 4, 4}},
+	}
+	for _, tt := range tests {
+		got := in.FillGaps(tt.fill, tt.maxGap)
+		for i, b := range got {
+			want := tt.want[i]
+			if math.IsNaN(want) {
+				if !math.IsNaN(b.Value) || b.Filled {
+					t.Errorf("%s: bucket %d = %+v, want unfilled gap", tt.name, i, b)
+				}
+				continue
+			}
+			if b.Value != want || b.Filled != in[i].Gap || b.Gap != in[i].Gap {
+				t.Errorf("%s: bucket %d = %+v, want %v", tt.name, i, b, want)
+			}
+		}
+	}
+	if !math.IsNaN(in[2].Value) {
+		t.Error("FillGaps changed its receiver")
+	}
+
+	filled := in.FillGaps(GapLinear, 1)
+	if got, want := filled.Series(), (Series{{60, 1}, {240, 4}, {300, 4}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Series() = %v, want %v", got, want)
+	}
+	if got, want := filled.Gaps(), []int64{0, 120, 180, 300}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Gaps() = %v, want %v", got, want)
+	}
+}
+
+func TestResampleDays(t *testing.T) {
+	loc := time.FixedZone("UTC+03:00", 3*3600)
+	s := Series{
+		{time.Date(2023, 11, 14, 23, 30, 0, 0, loc).Unix(), 1},
+		{time.Date(2023, 11, 15, 0, 30, 0, 0, loc).Unix(), 2},
+		{time.Date(2023, 11, 15, 12, 0, 0, 0, loc).Unix(), 4},
+	}
+	start := time.Date(2023, 11, 14, 12, 0, 0, 0, loc)
+	end := time.Date(2023, 11, 16, 6, 0, 0, 0, loc)
+
+	buckets := s.ResampleDays(start, end, loc, AggMean)
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets, want 3", len(buckets))
+	}
+	want := []struct {
+		day   int
+		value float64
+	}{{14, 1}, {15, 3}, {16, math.NaN()}}
+	for i, w := range want {
+		b := buckets[i]
+		if day := time.Date(2023, 11, w.day, 0, 0, 0, 0, loc).Unix(); b.Start != day {
+			t.Errorf("bucket %d starts at %v, want local midnight of %d", i, time.Unix(b.Start, 0).In(loc), w.day)
+		}
+		if math.IsNaN(w.value) != b.Gap || !b.Gap && b.Value != w.value {
+			t.Errorf("bucket %d = %+v, want %v", i, b, w.value)
+		}
+	}
+}
+
+func TestResampleDaysDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	// 2023-03-26 is 23 hours long
+	day := time.Date(2023, 3, 26, 0, 0, 0, 0, loc)
+	next := time.Date(2023, 3, 27, 0, 0, 0, 0, loc)
+	s := Series{{next.Add(-30 * time.Minute).Unix(), 1}, {next.Add(30 * time.Minute).Unix(), 2}}
+
+	buckets := s.ResampleDays(day.Add(10*time.Hour), next.Add(10*time.Hour), loc, AggLast)
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+	if buckets[0].Start != day.Unix() || buckets[1].Start != next.Unix() {
+		t.Errorf("buckets start at %d and %d, want %d and %d", buckets[0].Start, buckets[1].Start, day.Unix(), next.Unix())
+	}
+	if buckets[0].Value != 1 || buckets[1].Value != 2 {
+		t.Errorf("got %v and %v, want 1 and 2", buckets[0].Value, buckets[1].Value)
+	}
+}
@@ -0,0 +1,116 @@
+package zont
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Sample is one decoded point of load_data series
+type Sample struct {
+	Time  int64
+	Value float64
+}
+
+// Series is decoded load_data series ordered by time
+type Series []Sample
+
+// DecodeSeries convert raw load_data pairs [time, value] to Series.
+// Time of first pair is unix time, next ones may be sent relative to previous pair,
+// both forms are accepted. Pairs with empty value are skipped.
+func DecodeSeries[T any](raw [][]T) Series {
+	series := make(Series, 0, len(raw))
+	var prev int64
+	for i, pair := range raw {
+		if len(pair) < 2 {
+			continue
+		}
+		t, ok := toFloat(pair[0])
+		if !ok {
+			continue
+		}
+		ts := int64(t)
+		if i > 0 && math.Abs(t) < 1e9 {
+			ts = prev + ts
+		}
+		prev = ts
+
+		v, ok := toFloat(pair[1])
+		if !ok {
+			continue
+		}
+		series = append(series, Sample{Time: ts, Value: v})
+	}
+	return series
+}
+
+// Last return last sample of series
+func (s Series) Last() (Sample, bool) {
+	if len(s) == 0 {
+		return Sample{}, false
+	}
+	return s[len(s)-1], true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Merge return series with samples of both series ordered by time,
+// samples with same time are kept once
+func (s Series) Merge(other Series) Series {
+	merged := make(Series, 0, len(s)+len(other))
+	merged = append(merged, s...)
+	merged = append(merged, other...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Time < merged[j].Time })
+
+	result := merged[:0]
+	for i, sample := range merged {
+		if i > 0 && sample.Time == result[len(result)-1].Time {
+			result[len(result)-1] = sample
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// SeriesUnit return measurement unit of series key
+func SeriesUnit(key string) string {
+	switch DataType(key) {
+	case "temperature":
+		return "°C"
+	case "thermostat_work":
+		break
+	default:
+		return ""
+	}
+
+	name := key[strings.LastIndex(key, "/")+1:]
+	switch name {
+	case "dhw_t", "target_temp", "cs", "bt", "dt", "rwt":
+		return "°C"
+	case "rml":
+		return "%"
+	case "wp":
+		return "bar"
+	case "boiler_work_time", "worktime":
+		return "s"
+	}
+	return ""
+}
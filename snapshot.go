@@ -0,0 +1,255 @@
+package zont
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotVersion is format version of ConfigSnapshot
+const SnapshotVersion = 1
+
+// Config sections of device
+const (
+	SectionModes         = "modes"
+	SectionSchedule      = "schedule"
+	SectionThermometers  = "thermometers"
+	SectionNotifications = "notifications"
+	SectionOpenTherm     = "opentherm"
+	SectionPZA           = "pza"
+	SectionBoilerDelay   = "boiler_delay"
+	SectionLimits        = "limits"
+)
+
+// SnapshotSections is update_device fields of every config section
+var SnapshotSections = map[string][]string{
+	SectionModes:         {"thermostat_mode", "thermostat_ext_mode", "thermostat_ext_modes_config", "thermostat_ext_modes_advanced", "thermostat_target_temps", "thermostat_relay_mode"},
+	SectionSchedule:      {"tempschedule"},
+	SectionThermometers:  {"thermometers"},
+	SectionNotifications: {"notifications", "server_notifications", "trusted_phones"},
+	SectionOpenTherm:     {"ot_enabled", "ot_save_params", "ot_min_setpoint", "ot_max_setpoint", "ot_max_ml", "ot_dhw_setpoint", "ot_min_wp", "ot_config", "ot_mode", "ot_boiler_type", "ot_show_dhw_control", "ot_gate_enabled"},
+	SectionPZA:           {"pza", "pza_max_delta", "use_internet_weather_for_pza"},
+	SectionBoilerDelay:   {"boiler_delay"},
+	SectionLimits:        {"thermostat_temps_limits", "temperature_alarm", "thermostat_hysteresis", "tempstep"},
+}
+
+// thermometerState is read only state of thermometers, it is not saved
+var thermometerState = []string{"last_state", "last_value", "last_value_time"}
+
+// ConfigSnapshot is writable configuration of device
+type ConfigSnapshot struct {
+	Version         int                               `json:"version" yaml:"version"`
+	Created         time.Time                         `json:"created" yaml:"created"`
+	DeviceID        int                               `json:"device_id" yaml:"device_id"`
+	Serial          string                            `json:"serial" yaml:"serial"`
+	Name            string                            `json:"name" yaml:"name"`
+	DeviceType      string                            `json:"device_type" yaml:"device_type"`
+	FirmwareVersion []int                             `json:"firmware_version,omitempty" yaml:"firmware_version,omitempty"`
+	Sections        map[string]map[string]interface{} `json:"sections" yaml:"sections"`
+}
+
+// Snapshot return configuration of device as reported by ZONT, fields which Device
+// does not model are kept and fields which device does not report are not added
+func Snapshot(d *Device) *ConfigSnapshot {
+	s := &ConfigSnapshot{
+		Version:         SnapshotVersion,
+		Created:         time.Now().UTC(),
+		DeviceID:        d.ID,
+		Serial:          d.Serial,
+		Name:            d.Name,
+		DeviceType:      d.DeviceType.Code,
+		FirmwareVersion: d.FirmwareVersion,
+		Sections:        map[string]map[string]interface{}{},
+	}
+
+	fields := rawMap(d)
+	for section, keys := range SnapshotSections {
+		values := map[string]interface{}{}
+		for _, key := range keys {
+			if value, ok := fields[key]; ok {
+				values[key] = value
+			}
+		}
+		if len(values) > 0 {
+			s.Sections[section] = values
+		}
+	}
+
+	if values, ok := s.Sections[SectionThermometers]; ok {
+		if list, ok := values["thermometers"].([]interface{}); ok {
+			for _, item := range list {
+				if t, ok := item.(map[string]interface{}); ok {
+					for _, key := range thermometerState {
+						delete(t, key)
+					}
+				}
+			}
+		}
+	}
+	return s
+}
+
+// SectionNames return sorted names of sections in snapshot
+func (s *ConfigSnapshot) SectionNames() []string {
+	names := make([]string, 0, len(s.Sections))
+	for name := range s.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply write sections of snapshot into d, all sections when none is given
+func (s *ConfigSnapshot) Apply(d *Device, sections ...string) error {
+	if len(sections) == 0 {
+		sections = s.SectionNames()
+	}
+	for _, section := range sections {
+		values, ok := s.Sections[section]
+		if !ok {
+			return fmt.Errorf("snapshot has no section %q", section)
+		}
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, d); err != nil {
+			return fmt.Errorf("section %s: %w", section, err)
+		}
+	}
+	return nil
+}
+
+// WriteJSON write snapshot as indented JSON
+func (s *ConfigSnapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteYAML write snapshot as YAML
+func (s *ConfigSnapshot) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ReadSnapshot read snapshot in JSON or YAML
+func ReadSnapshot(r io.Reader) (*ConfigSnapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ConfigSnapshot{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(data, s)
+	} else {
+		err = yaml.Unmarshal(data, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is newer than supported %d", s.Version, SnapshotVersion)
+	}
+	return s, nil
+}
+
+// SaveSnapshot write snapshot to file, format is YAML for .yaml and .yml files and JSON otherwise
+func SaveSnapshot(path string, s *ConfigSnapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = s.WriteYAML(f)
+	default:
+		err = s.WriteJSON(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// LoadSnapshot read snapshot from file
+func LoadSnapshot(path string) (*ConfigSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// BackupDevice return snapshot of current device configuration
+func (cl *Client) BackupDevice(deviceId int) (*ConfigSnapshot, error) {
+	cl.InvalidateDevices()
+	d, err := cl.Device(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return Snapshot(d), nil
+}
+
+// applyPatch set sections of snapshot in patch, all sections when none is given
+func (s *ConfigSnapshot) applyPatch(p *DevicePatch, sections ...string) error {
+	if len(sections) == 0 {
+		sections = s.SectionNames()
+	}
+	for _, section := range sections {
+		values, ok := s.Sections[section]
+		if !ok {
+			return fmt.Errorf("snapshot has no section %q", section)
+		}
+		for key, value := range values {
+			p.Set(key, value)
+		}
+	}
+	return nil
+}
+
+// RestorePatch return patch which restore sections of snapshot on device, use
+// String or DryRun of patch to preview changes and ApplyPatch to write them.
+// Snapshot of another device is rejected, thermometer uuids and serials of it
+// do not exist on device, use CloneConfig to copy configuration between devices.
+func (cl *Client) RestorePatch(deviceId int, s *ConfigSnapshot, sections ...string) (*DevicePatch, error) {
+	p, err := cl.NewPatch(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if s.DeviceID != deviceId {
+		return nil, fmt.Errorf("snapshot of device %d (serial %s) can not be restored on device %d (serial %s)",
+			s.DeviceID, s.Serial, deviceId, p.original.Serial)
+	}
+	if s.DeviceType != p.original.DeviceType.Code {
+		return nil, fmt.Errorf("snapshot of device type %q can not be restored on device type %q",
+			s.DeviceType, p.original.DeviceType.Code)
+	}
+	if err := s.applyPatch(p, sections...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// RestoreDevice write sections of snapshot to device and return applied patch
+func (cl *Client) RestoreDevice(deviceId int, s *ConfigSnapshot, sections ...string) (*DevicePatch, error) {
+	p, err := cl.RestorePatch(deviceId, s, sections...)
+	if err != nil {
+		return nil, err
+	}
+	return p, cl.ApplyPatch(p)
+}
@@ -0,0 +1,144 @@
+package zont
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const snapshotDevice = `{"id":7,"serial":"0123","device_type":{"code":"H2000+","name":"ZONT H2000+"},
+	"thermostat_ext_modes_config":{"1":{"active":true,"name":"Comfort","zone_temp":{"1":21,"2":19},"zone_sensors":{"1":null,"2":"uuid-2"}}},
+	"notifications":{"guard":{"numbers":"+7900","on":"sms","off":"sms","extra":"call"}},
+	"thermometers":[{"uuid":"uuid-2","serial":"28FF","slot":2,"name":"Hall","offset":-0.5,"last_value":20.5,"last_value_time":1700000000}],
+	"thermostat_hysteresis":0.5}`
+
+func TestSnapshotKeepsDeviceJSON(t *testing.T) {
+	s := Snapshot(testDevice(t, snapshotDevice))
+
+	modes := s.Sections[SectionModes]["thermostat_ext_modes_config"].(map[string]interface{})["1"].(map[string]interface{})
+	if modes["zone_temp"].(map[string]interface{})["2"] != 19.0 || modes["zone_sensors"].(map[string]interface{})["2"] != "uuid-2" {
+		t.Errorf("zone 2 is dropped: %v", modes)
+	}
+	if _, ok := s.Sections[SectionModes]["thermostat_mode"]; ok {
+		t.Error("unreported thermostat_mode is added")
+	}
+
+	notifications := s.Sections[SectionNotifications]["notifications"].(map[string]interface{})
+	if notifications["guard"].(map[string]interface{})["extra"] != "call" {
+		t.Errorf("guard.extra is dropped: %v", notifications)
+	}
+	if _, ok := notifications["alarm"]; ok {
+		t.Errorf("unreported alarm is added: %v", notifications)
+	}
+
+	thermometer := s.Sections[SectionThermometers]["thermometers"].([]interface{})[0].(map[string]interface{})
+	if thermometer["offset"] != -0.5 {
+		t.Errorf("thermometer offset is dropped: %v", thermometer)
+	}
+	if _, ok := thermometer["last_value"]; ok {
+		t.Errorf("thermometer state is saved: %v", thermometer)
+	}
+
+	for _, section := range []string{SectionPZA, SectionOpenTherm, SectionBoilerDelay, SectionSchedule} {
+		if values, ok := s.Sections[section]; ok {
+			t.Errorf("unreported section %s is added: %v", section, values)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	s := Snapshot(testDevice(t, snapshotDevice))
+	for name, write := range map[string]func(io.Writer) error{"json": s.WriteJSON, "yaml": s.WriteYAML} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadSnapshot(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for section, values := range s.Sections {
+			if got := jsonValue(read.Sections[section]); !reflect.DeepEqual(got, jsonValue(values)) {
+				t.Errorf("%s: section %s = %v, want %v", name, section, got, values)
+			}
+		}
+		if read.DeviceID != 7 || read.DeviceType != "H2000+" || read.Serial != "0123" {
+			t.Errorf("%s: header = %+v", name, read)
+		}
+	}
+}
+
+func TestRestoreDevice(t *testing.T) {
+	s := Snapshot(testDevice(t, snapshotDevice))
+
+	// configuration changed after snapshot
+	current := strings.NewReplacer(`"+7900"`, `"+7999"`, `"2":19`, `"2":17`, `"offset":-0.5`, `"offset":0`).Replace(snapshotDevice)
+	var payload map[string]interface{}
+	updates := 0
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			w.Write([]byte(`{"ok":true,"devices":[` + current + `]}`))
+		case strings.HasSuffix(r.URL.Path, "/update_device"):
+			updates++
+			json.NewDecoder(r.Body).Decode(&payload)
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+
+	p, err := cl.RestoreDevice(7, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, c := range p.Diff() {
+		paths = append(paths, c.Path)
+	}
+	want := "notifications.guard.numbers,thermometers,thermostat_ext_modes_config.1.zone_temp.2"
+	if strings.Join(paths, ",") != want {
+		t.Errorf("diff = %v, want %s", paths, want)
+	}
+	if updates != 1 {
+		t.Fatalf("got %d updates, want 1", updates)
+	}
+	if len(payload) != 4 {
+		t.Errorf("payload = %v, want device_id and 3 changed fields", payload)
+	}
+	guard := payload["notifications"].(map[string]interface{})["guard"].(map[string]interface{})
+	if guard["numbers"] != "+7900" || guard["extra"] != "call" {
+		t.Errorf("guard = %v", guard)
+	}
+	thermometer := payload["thermometers"].([]interface{})[0].(map[string]interface{})
+	if thermometer["offset"] != -0.5 || thermometer["uuid"] != "uuid-2" {
+		t.Errorf("thermometer = %v", thermometer)
+	}
+
+	current = snapshotDevice
+	cl.InvalidateDevices()
+	if p, err := cl.RestorePatch(7, s); err != nil || !p.Empty() {
+		t.Errorf("restore of unchanged device: %v %v", p.Payload(), err)
+	}
+}
+
+func TestRestoreOtherDevice(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[`+snapshotDevice+`]}`, &updates))
+
+	other := Snapshot(testDevice(t, snapshotDevice))
+	other.DeviceID = 8
+	if _, err := cl.RestorePatch(7, other); err == nil {
+		t.Error("snapshot of another device is restored")
+	}
+	otherType := Snapshot(testDevice(t, snapshotDevice))
+	otherType.DeviceType = "L1000"
+	if _, err := cl.RestoreDevice(7, otherType); err == nil {
+		t.Error("snapshot of another device type is restored")
+	}
+	if updates != 0 {
+		t.Errorf("got %d updates, want 0", updates)
+	}
+}
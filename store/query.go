@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dematron/go-zont"
+)
+
+// Aggregate is summary of series samples in range
+type Aggregate struct {
+	Count int
+	Min   float64
+	Max   float64
+	Mean  float64
+	First zont.Sample
+	Last  zont.Sample
+}
+
+// Series return stored series keys of device
+func (s *Store) Series(ctx context.Context, deviceId int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT series FROM samples WHERE device_id = ? ORDER BY series`, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Name return name of series, for temperature series it is sensor name
+func (s *Store) Name(ctx context.Context, deviceId int, series string) (string, error) {
+	var name string
+	err := s.db.QueryRowContext(ctx, `SELECT name FROM series_names WHERE device_id = ? AND series = ?`, deviceId, series).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// Range return samples of series with time in from - to
+func (s *Store) Range(ctx context.Context, deviceId int, series string, from, to time.Time) (zont.Series, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT time, value FROM samples
+		WHERE device_id = ? AND series = ? AND time >= ? AND time <= ? ORDER BY time`,
+		deviceId, series, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result zont.Series
+	for rows.Next() {
+		var sample zont.Sample
+		if err := rows.Scan(&sample.Time, &sample.Value); err != nil {
+			return nil, err
+		}
+		result = append(result, sample)
+	}
+	return result, rows.Err()
+}
+
+// Latest return last sample of series
+func (s *Store) Latest(ctx context.Context, deviceId int, series string) (sample zont.Sample, ok bool, err error) {
+	err = s.db.QueryRowContext(ctx, `SELECT time, value FROM samples WHERE device_id = ? AND series = ? ORDER BY time DESC LIMIT 1`,
+		deviceId, series).Scan(&sample.Time, &sample.Value)
+	if err == sql.ErrNoRows {
+		return sample, false, nil
+	}
+	return sample, err == nil, err
+}
+
+// Aggregate return summary of series samples with time in from - to
+func (s *Store) Aggregate(ctx context.Context, deviceId int, series string, from, to time.Time) (Aggregate, error) {
+	a := Aggregate{}
+	var min, max, mean sql.NullFloat64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), MIN(value), MAX(value), AVG(value) FROM samples
+		WHERE device_id = ? AND series = ? AND time >= ? AND time <= ?`,
+		deviceId, series, from.Unix(), to.Unix()).Scan(&a.Count, &min, &max, &mean)
+	if err != nil || a.Count == 0 {
+		return a, err
+	}
+	a.Min, a.Max, a.Mean = min.Float64, max.Float64, mean.Float64
+
+	err = s.db.QueryRowContext(ctx, `SELECT time, value FROM samples
+		WHERE device_id = ? AND series = ? AND time >= ? AND time <= ? ORDER BY time LIMIT 1`,
+		deviceId, series, from.Unix(), to.Unix()).Scan(&a.First.Time, &a.First.Value)
+	if err != nil {
+		return a, err
+	}
+	err = s.db.QueryRowContext(ctx, `SELECT time, value FROM samples
+		WHERE device_id = ? AND series = ? AND time >= ? AND time <= ? ORDER BY time DESC LIMIT 1`,
+		deviceId, series, from.Unix(), to.Unix()).Scan(&a.Last.Time, &a.Last.Value)
+	return a, err
+}
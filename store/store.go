@@ -0,0 +1,215 @@
+// Package store mirror ZONT load_data history into local SQLite database.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/dematron/go-zont"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS samples (
+	device_id INTEGER NOT NULL,
+	series    TEXT    NOT NULL,
+	time      INTEGER NOT NULL,
+	value     REAL    NOT NULL,
+	PRIMARY KEY (device_id, series, time)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS series_names (
+	device_id INTEGER NOT NULL,
+	series    TEXT    NOT NULL,
+	name      TEXT    NOT NULL,
+	PRIMARY KEY (device_id, series)
+);
+
+CREATE TABLE IF NOT EXISTS synced_ranges (
+	device_id INTEGER NOT NULL,
+	data_type TEXT    NOT NULL,
+	min_time  INTEGER NOT NULL,
+	max_time  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS synced_ranges_device ON synced_ranges (device_id, data_type, min_time);
+`
+
+// defaultLateMargin is time GSM controllers can upload data late
+const defaultLateMargin = time.Hour
+
+// Store is local history database
+type Store struct {
+	db *sql.DB
+	// LateMargin is last part of downloaded range which is not marked synced, so
+	// data uploaded late by controller is downloaded by next Sync. One hour by default
+	LateMargin time.Duration
+}
+
+// Open open or create database in file path
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allow one writer, keep writes serialized
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, LateMargin: defaultLateMargin}, nil
+}
+
+// Close close database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save write samples of history, existing samples with same time are replaced
+func (s *Store) Save(ctx context.Context, history *zont.History) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO samples (device_id, series, time, value) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for key, series := range history.Series {
+		for _, sample := range series {
+			if _, err := insert.ExecContext(ctx, history.DeviceID, key, sample.Time, sample.Value); err != nil {
+				return err
+			}
+		}
+	}
+	for key, name := range history.Names {
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO series_names (device_id, series, name) VALUES (?, ?, ?)`, history.DeviceID, key, name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addSynced mark range of data type as downloaded, overlapping ranges are joined
+func (s *Store) addSynced(ctx context.Context, deviceId int, dataType string, from, to int64) error {
+	if to <= from {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `SELECT COALESCE(MIN(min_time), ?), COALESCE(MAX(max_time), ?) FROM synced_ranges
+		WHERE device_id = ? AND data_type = ? AND min_time <= ? AND max_time >= ?`, from, to, deviceId, dataType, to, from)
+	var min, max int64
+	if err := row.Scan(&min, &max); err != nil {
+		return err
+	}
+	if min > from {
+		min = from
+	}
+	if max < to {
+		max = to
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM synced_ranges WHERE device_id = ? AND data_type = ? AND min_time <= ? AND max_time >= ?`,
+		deviceId, dataType, to, from); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO synced_ranges (device_id, data_type, min_time, max_time) VALUES (?, ?, ?, ?)`,
+		deviceId, dataType, min, max); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Gaps return not downloaded parts of range from - to
+func (s *Store) Gaps(ctx context.Context, deviceId int, dataType string, from, to time.Time) ([][2]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT min_time, max_time FROM synced_ranges
+		WHERE device_id = ? AND data_type = ? AND max_time > ? AND min_time < ? ORDER BY min_time`,
+		deviceId, dataType, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gaps [][2]time.Time
+	cursor := from.Unix()
+	for rows.Next() {
+		var min, max int64
+		if err := rows.Scan(&min, &max); err != nil {
+			return nil, err
+		}
+		if min > cursor {
+			gaps = append(gaps, [2]time.Time{time.Unix(cursor, 0), time.Unix(min, 0)})
+		}
+		if max > cursor {
+			cursor = max
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if cursor < to.Unix() {
+		gaps = append(gaps, [2]time.Time{time.Unix(cursor, 0), to})
+	}
+	return gaps, nil
+}
+
+// LastSynced return end of last downloaded range of data type
+func (s *Store) LastSynced(ctx context.Context, deviceId int, dataType string) (last time.Time, ok bool, err error) {
+	var max sql.NullInt64
+	err = s.db.QueryRowContext(ctx, `SELECT MAX(max_time) FROM synced_ranges WHERE device_id = ? AND data_type = ?`,
+		deviceId, dataType).Scan(&max)
+	if err != nil || !max.Valid {
+		return last, false, err
+	}
+	return time.Unix(max.Int64, 0), true, nil
+}
+
+// Backfill download every not downloaded part of range from - to
+func (s *Store) Backfill(ctx context.Context, client *zont.Client, deviceId int, dataType string, from, to time.Time) error {
+	gaps, err := s.Gaps(ctx, deviceId, dataType, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, gap := range gaps {
+		req := zont.HistoryRequest{
+			DeviceID:  deviceId,
+			DataTypes: []string{dataType},
+			MinTime:   gap[0].Unix(),
+			MaxTime:   gap[1].Unix(),
+		}
+		until, err := client.LoadHistory(ctx, req, func(h *zont.History) error {
+			return s.Save(ctx, h)
+		})
+		// recent data can still be uploaded, leave it for next Sync
+		if late := time.Now().Add(-s.LateMargin).Unix(); until > late {
+			until = late
+		}
+		// keep downloaded part even when load was interrupted
+		if markErr := s.addSynced(ctx, deviceId, dataType, req.MinTime, until); markErr != nil {
+			return markErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync download data type from last synced time up to now, since is used
+// when device was never synced. Gaps after since are backfilled too.
+func (s *Store) Sync(ctx context.Context, client *zont.Client, deviceId int, dataType string, since time.Time) error {
+	return s.Backfill(ctx, client, deviceId, dataType, since, time.Now())
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dematron/go-zont"
+)
+
+// fakeZont answer load_data with one temperature sample per window start and
+// record requested ranges
+type fakeZont struct {
+	mu     sync.Mutex
+	ranges [][2]int64
+}
+
+func (f *fakeZont) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req zont.LoadDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dr := req.Requests[0]
+	f.mu.Lock()
+	f.ranges = append(f.ranges, [2]int64{dr.MinTime, dr.MaxTime})
+	f.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok": true,
+		"responses": []any{map[string]any{
+			"device_id":   dr.DeviceID,
+			"ok":          true,
+			"temperature": map[string]any{"t1": map[string]any{"temperature": [][]float64{{float64(dr.MinTime), 21}}}},
+		}},
+	})
+}
+
+func TestSyncLeavesLateMargin(t *testing.T) {
+	api := &fakeZont{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	client := zont.NewClient("test", "test", "login", "password")
+	client.SetBaseURL(srv.URL + "/")
+	client.AuthTokenResponse = &zont.AuthTokenResponse{Token: "token"}
+
+	s, err := Open(filepath.Join(t.TempDir(), "zont.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	ctx := context.Background()
+	since := time.Now().Add(-6 * time.Hour)
+	if err := s.Sync(ctx, client, 7, "temperature", since); err != nil {
+		t.Fatal(err)
+	}
+
+	last, ok, err := s.LastSynced(ctx, 7, "temperature")
+	if err != nil || !ok {
+		t.Fatalf("LastSynced = %v %v %v", last, ok, err)
+	}
+	if margin := time.Since(last); margin < 59*time.Minute || margin > 61*time.Minute {
+		t.Errorf("synced until %s ago, want one hour margin", margin)
+	}
+	gaps, err := s.Gaps(ctx, 7, "temperature", since, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 || !gaps[0][0].Equal(last) {
+		t.Errorf("gaps = %v, want last hour", gaps)
+	}
+
+	api.mu.Lock()
+	api.ranges = nil
+	api.mu.Unlock()
+	if err := s.Sync(ctx, client, 7, "temperature", since); err != nil {
+		t.Fatal(err)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.ranges) != 1 || api.ranges[0][0] != last.Unix() {
+		t.Errorf("second sync requested %v, want from %d", api.ranges, last.Unix())
+	}
+}
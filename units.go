@@ -0,0 +1,210 @@
+package zont
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// Celsius is temperature stored in hundredths of degree, so 21.5 stays 21.5
+type Celsius int64
+
+// Bar is pressure stored in hundredths of bar
+type Bar int64
+
+// Percent is percentage stored in hundredths of percent
+type Percent int64
+
+const (
+	Degree     Celsius = 100
+	OneBar     Bar     = 100
+	OnePercent Percent = 100
+)
+
+func toHundredths(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func formatHundredths(v int64) string {
+	return strconv.FormatFloat(float64(v)/100, 'f', -1, 64)
+}
+
+// NewCelsius return temperature rounded to hundredths of degree
+func NewCelsius(v float64) Celsius {
+	return Celsius(toHundredths(v))
+}
+
+// FromFahrenheit return temperature of f degrees Fahrenheit
+func FromFahrenheit(f float64) Celsius {
+	return NewCelsius((f - 32) * 5 / 9)
+}
+
+// Float64 return temperature in degrees
+func (c Celsius) Float64() float64 {
+	return float64(c) / 100
+}
+
+// Fahrenheit return temperature in degrees Fahrenheit
+func (c Celsius) Fahrenheit() float64 {
+	return c.Float64()*9/5 + 32
+}
+
+// Round return temperature rounded to nearest multiple of step
+func (c Celsius) Round(step Celsius) Celsius {
+	if step <= 0 {
+		return c
+	}
+	return Celsius(math.Round(float64(c)/float64(step))) * step
+}
+
+// String return temperature like "21.5 °C"
+func (c Celsius) String() string {
+	return formatHundredths(int64(c)) + " °C"
+}
+
+func (c Celsius) MarshalJSON() ([]byte, error) {
+	return []byte(formatHundredths(int64(c))), nil
+}
+
+func (c *Celsius) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalHundredths(data)
+	*c = Celsius(v)
+	return err
+}
+
+// NewBar return pressure rounded to hundredths of bar
+func NewBar(v float64) Bar {
+	return Bar(toHundredths(v))
+}
+
+// Float64 return pressure in bar
+func (b Bar) Float64() float64 {
+	return float64(b) / 100
+}
+
+// String return pressure like "1.5 bar"
+func (b Bar) String() string {
+	return formatHundredths(int64(b)) + " bar"
+}
+
+func (b Bar) MarshalJSON() ([]byte, error) {
+	return []byte(formatHundredths(int64(b))), nil
+}
+
+func (b *Bar) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalHundredths(data)
+	*b = Bar(v)
+	return err
+}
+
+// NewPercent return percentage rounded to hundredths of percent
+func NewPercent(v float64) Percent {
+	return Percent(toHundredths(v))
+}
+
+// Float64 return percentage, 100 is whole
+func (p Percent) Float64() float64 {
+	return float64(p) / 100
+}
+
+// Fraction return percentage as part of whole, 0 - 1
+func (p Percent) Fraction() float64 {
+	return p.Float64() / 100
+}
+
+// String return percentage like "45 %"
+func (p Percent) String() string {
+	return formatHundredths(int64(p)) + " %"
+}
+
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(formatHundredths(int64(p))), nil
+}
+
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalHundredths(data)
+	*p = Percent(v)
+	return err
+}
+
+// unmarshalHundredths read number, quoted number or null
+func unmarshalHundredths(data []byte) (int64, error) {
+	data = bytes.Trim(bytes.TrimSpace(data), `"`)
+	if len(data) == 0 || string(data) == "null" {
+		return 0, nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return 0, err
+	}
+	return toHundredths(f), nil
+}
+
+// Celsius return sample value as temperature
+func (s Sample) Celsius() Celsius {
+	return NewCelsius(s.Value)
+}
+
+// Bar return sample value as pressure
+func (s Sample) Bar() Bar {
+	return NewBar(s.Value)
+}
+
+// Percent return sample value as percentage
+func (s Sample) Percent() Percent {
+	return NewPercent(s.Value)
+}
+
+// DefaultTempStep is setpoint step of device which does not report Tempstep
+const DefaultTempStep = Degree / 10
+
+// TempstepUnit is unit of Device.Tempstep. ZONT API docs do not describe the
+// field, it is taken as tenths of degree; change it or set step of device with
+// Client.SetTempStep when controller reports it otherwise.
+var TempstepUnit = Degree / 10
+
+// TempStep return setpoint step of device: step set by Client.SetTempStep,
+// Tempstep in TempstepUnit or DefaultTempStep when device does not report it
+func (d *Device) TempStep() Celsius {
+	switch {
+	case d.tempStep > 0:
+		return d.tempStep
+	case d.Tempstep > 0:
+		return Celsius(d.Tempstep) * TempstepUnit
+	}
+	return DefaultTempStep
+}
+
+// tempSteps is setpoint steps of devices set by Client.SetTempStep
+type tempSteps struct {
+	mu    sync.Mutex
+	steps map[int]Celsius
+}
+
+// apply set step of device when it is configured
+func (s *tempSteps) apply(d *Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if step, ok := s.steps[d.ID]; ok {
+		d.tempStep = step
+	}
+}
+
+// SetTempStep set setpoint step of device used instead of Tempstep of devices
+// response, zero step remove it
+func (cl *Client) SetTempStep(deviceId int, step Celsius) {
+	s := cl.tempSteps
+	s.mu.Lock()
+	if s.steps == nil {
+		s.steps = map[int]Celsius{}
+	}
+	if step > 0 {
+		s.steps[deviceId] = step
+	} else {
+		delete(s.steps, deviceId)
+	}
+	s.mu.Unlock()
+	cl.InvalidateDevices()
+}
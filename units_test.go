@@ -0,0 +1,178 @@
+package zont
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestNewCelsius(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Celsius
+	}{
+		{21.5, 2150},
+		{21.499999, 2150},
+		{21.500001, 2150},
+		{0.1 + 0.2, 30},
+		{-3.25, -325},
+		{0, 0},
+		{85.004, 8500},
+		{85.006, 8501},
+	}
+	for _, tt := range tests {
+		if got := NewCelsius(tt.in); got != tt.want {
+			t.Errorf("NewCelsius(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCelsiusRound(t *testing.T) {
+	tests := []struct {
+		in, step, want Celsius
+	}{
+		{2149, 50, 2150},
+		{2124, 50, 2100},
+		{2125, 50, 2150},
+		{-2125, 50, -2150},
+		{2153, 10, 2150},
+		{2153, 0, 2153},
+		{2153, -10, 2153},
+		{NewCelsius(21.499999), DefaultTempStep, 2150},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Round(tt.step); got != tt.want {
+			t.Errorf("%d.Round(%d) = %d, want %d", tt.in, tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestCelsiusMarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   Celsius
+		want string
+	}{
+		{2150, "21.5"},
+		{2100, "21"},
+		{2155, "21.55"},
+		{-50, "-0.5"},
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%d) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCelsiusUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Celsius
+		fail bool
+	}{
+		{`21.5`, 2150, false},
+		{`21`, 2100, false},
+		{`21.499999`, 2150, false},
+		{`"21.5"`, 2150, false},
+		{`" 7 "`, 700, false},
+		{`null`, 0, false},
+		{`""`, 0, false},
+		{`-0.5`, -50, false},
+		{`"warm"`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		var got Celsius
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.fail {
+			t.Errorf("Unmarshal(%s) error = %v, want fail %v", tt.in, err, tt.fail)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	var target ThermostatTargetTemps
+	if err := json.Unmarshal([]byte(`{"manual":true,"temp":21.499999}`), &target); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(target); string(data) != `{"manual":true,"temp":21.5}` {
+		t.Errorf("round trip of ThermostatTargetTemps = %s", data)
+	}
+}
+
+func TestFahrenheit(t *testing.T) {
+	tests := []struct {
+		f float64
+		c Celsius
+	}{
+		{32, 0},
+		{212, 10000},
+		{-40, -4000},
+		{70.7, 2150},
+	}
+	for _, tt := range tests {
+		if got := FromFahrenheit(tt.f); got != tt.c {
+			t.Errorf("FromFahrenheit(%v) = %d, want %d", tt.f, got, tt.c)
+		}
+		if got := tt.c.Fahrenheit(); math.Abs(got-tt.f) > 1e-9 {
+			t.Errorf("%d.Fahrenheit() = %v, want %v", tt.c, got, tt.f)
+		}
+	}
+
+	for c := Celsius(-5000); c <= 15000; c++ {
+		if got := FromFahrenheit(c.Fahrenheit()); got != c {
+			t.Fatalf("FromFahrenheit(%d.Fahrenheit()) = %d", c, got)
+		}
+	}
+}
+
+func TestBarPercent(t *testing.T) {
+	if b := NewBar(1.499999); b != 150 || b.String() != "1.5 bar" {
+		t.Errorf("NewBar(1.499999) = %d %s", b, b)
+	}
+	if p := NewPercent(45.5); p.Fraction() != 0.455 || p.String() != "45.5 %" {
+		t.Errorf("NewPercent(45.5) = %v %s", p.Fraction(), p)
+	}
+
+	var v struct {
+		Bar     Bar     `json:"bar"`
+		Percent Percent `json:"percent"`
+	}
+	if err := json.Unmarshal([]byte(`{"bar":"1.2","percent":null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Bar != 120 || v.Percent != 0 {
+		t.Errorf("got %d %d", v.Bar, v.Percent)
+	}
+}
+
+func TestTempStep(t *testing.T) {
+	tests := []struct {
+		tempstep int
+		override Celsius
+		want     Celsius
+	}{
+		{0, 0, DefaultTempStep},
+		{1, 0, Degree / 10},
+		{5, 0, Degree / 2},
+		{10, 0, Degree},
+		{0, Degree / 2, Degree / 2},
+		{5, Degree, Degree},
+	}
+	for _, tt := range tests {
+		d := &Device{Tempstep: tt.tempstep, tempStep: tt.override}
+		if got := d.TempStep(); got != tt.want {
+			t.Errorf("TempStep with tempstep %d and step %s = %s, want %s", tt.tempstep, tt.override, got, tt.want)
+		}
+	}
+	if DefaultTempStep.Float64() != 0.1 {
+		t.Errorf("DefaultTempStep = %v", DefaultTempStep.Float64())
+	}
+}
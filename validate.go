@@ -0,0 +1,243 @@
+package zont
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type ValidationMode int
+
+const (
+	// ValidateStrict return error for setpoint out of device limits or not multiple of TempStep
+	ValidateStrict ValidationMode = iota
+	// ValidateClamp move setpoint into device limits and round it to TempStep
+	ValidateClamp
+	// ValidateOff send setpoint as is
+	ValidateOff
+)
+
+const defaultDeviceCacheTTL = 5 * time.Minute
+
+// Zone setpoint limits used when device has no own limits
+var (
+	DefaultMinZoneTemp = 5 * Degree
+	DefaultMaxZoneTemp = 35 * Degree
+)
+
+// noLimit is limit of coolant zone when neither zone nor boiler report it
+const noLimit = Celsius(math.MaxInt64)
+
+// SetpointError is returned for setpoint which can not be sent to device
+type SetpointError struct {
+	DeviceID int
+	Zone     string
+	Value    Celsius
+	Min      Celsius
+	Max      Celsius
+	Step     Celsius
+}
+
+func (e *SetpointError) Error() string {
+	if e.Max == noLimit && e.Value < e.Min {
+		return fmt.Sprintf("setpoint %s of device %d zone %s is below limit %s",
+			e.Value, e.DeviceID, e.Zone, e.Min)
+	}
+	if e.Value < e.Min || e.Value > e.Max {
+		return fmt.Sprintf("setpoint %s of device %d zone %s is out of limits %s - %s",
+			e.Value, e.DeviceID, e.Zone, e.Min, e.Max)
+	}
+	return fmt.Sprintf("setpoint %s of device %d zone %s is not multiple of step %s",
+		e.Value, e.DeviceID, e.Zone, e.Step)
+}
+
+type writeOptions struct {
+	validation ValidationMode
+	// validationSet is true when WithValidation is given
+	validationSet   bool
+	confirmTimeout  time.Duration
+	confirmInterval time.Duration
+	correlationID   string
+	coolant         bool
+	ctx             context.Context
+	dryRun          bool
+	result          *WriteResult
+	// diff is audit diff of write, loaded from device when not set
+	diff []FieldChange
+}
+
+// WriteOption change behaviour of write helpers like SetTargetTemp
+type WriteOption func(*writeOptions)
+
+// WithValidation set validation mode of one write, client mode is used otherwise
+func WithValidation(mode ValidationMode) WriteOption {
+	return func(o *writeOptions) {
+		o.validation = mode
+		o.validationSet = true
+	}
+}
+
+// WithClamp move setpoint into device limits and round it instead of error
+func WithClamp() WriteOption {
+	return WithValidation(ValidateClamp)
+}
+
+// WithCoolantZone validate setpoint of zone regulated by coolant temperature
+// with CoolantLimits instead of ZoneLimits
+func WithCoolantZone() WriteOption {
+	return func(o *writeOptions) {
+		o.coolant = true
+	}
+}
+
+func (cl *Client) writeOptions(opts []WriteOption) *writeOptions {
+	o := &writeOptions{validation: cl.validation, dryRun: cl.dryRun}
+	for _, opt := range opts {
+		opt(o)
+	}
+	// dry run is used to check writes, so they are validated even when client
+	// validation is off
+	if o.dryRun && !o.validationSet {
+		o.validation = ValidateStrict
+	}
+	return o
+}
+
+// SetValidation set default validation mode of setpoints, ValidateStrict by default.
+// Setpoints are checked against cached devices, ValidateOff send them as is.
+func (cl *Client) SetValidation(mode ValidationMode) {
+	cl.validation = mode
+}
+
+// deviceCache keep devices for validation without request on every write
+type deviceCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	loaded  time.Time
+	devices map[int]Device
+}
+
+// Device return device with deviceId from cache, devices are loaded again when
+// cache is older than five minutes
+func (cl *Client) Device(deviceId int) (*Device, error) {
+	c := cl.devices
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.devices == nil || time.Since(c.loaded) > c.ttl {
+		if cl.AuthTokenResponse == nil || len(cl.AuthTokenResponse.Token) < 1 {
+			return nil, errors.New("AuthToken not exist")
+		}
+		resp := cl.GetDevices()
+		if resp == nil || !resp.Ok {
+			return nil, errors.New("devices request failed")
+		}
+		c.devices = map[int]Device{}
+		for _, d := range resp.Devices {
+			c.devices[d.ID] = d
+		}
+		c.loaded = time.Now()
+	}
+
+	d, ok := c.devices[deviceId]
+	if !ok {
+		return nil, fmt.Errorf("device %d not found", deviceId)
+	}
+	return &d, nil
+}
+
+// InvalidateDevices drop cached devices, next Device call load them again
+func (cl *Client) InvalidateDevices() {
+	cl.devices.mu.Lock()
+	cl.devices.devices = nil
+	cl.devices.mu.Unlock()
+}
+
+// reportedLimits return limits of zone from ThermostatTempsLimits, limits of "0"
+// apply to all zones and limits of "1" to zone "1". min and max are kept when
+// device does not report them.
+func (d *Device) reportedLimits(zone string, min, max Celsius) (Celsius, Celsius) {
+	apply := func(minValue, maxValue interface{}) {
+		if v, ok := toFloat(minValue); ok {
+			min = NewCelsius(v)
+		}
+		if v, ok := toFloat(maxValue); ok {
+			max = NewCelsius(v)
+		}
+	}
+
+	limits := d.ThermostatTempsLimits
+	apply(limits.Num0.Min, limits.Num0.Max)
+	if zone == "1" {
+		apply(limits.Num1.Min, limits.Num1.Max)
+	}
+	return min, max
+}
+
+// ZoneLimits return setpoint limits of zone from ThermostatTempsLimits,
+// DefaultMinZoneTemp and DefaultMaxZoneTemp are used when device has no limits.
+// With OpenTherm max is lowered to OtMaxSetpoint, no zone can be heated above max
+// flow temperature of boiler.
+func (d *Device) ZoneLimits(zone string) (min, max Celsius) {
+	min, max = d.reportedLimits(zone, DefaultMinZoneTemp, DefaultMaxZoneTemp)
+	if d.OtEnabled && d.OtMaxSetpoint > 0 && max > d.OtMaxSetpoint {
+		max = d.OtMaxSetpoint
+	}
+	return min, max
+}
+
+// CoolantLimits return setpoint limits of zone regulated by coolant temperature:
+// limits of zone narrowed to OtMinSetpoint - OtMaxSetpoint of OpenTherm boiler.
+// Range is not limited when neither zone nor boiler report limits.
+func (d *Device) CoolantLimits(zone string) (min, max Celsius) {
+	min, max = d.reportedLimits(zone, 0, noLimit)
+	if d.OtEnabled {
+		if d.OtMinSetpoint > 0 && min < d.OtMinSetpoint {
+			min = d.OtMinSetpoint
+		}
+		if d.OtMaxSetpoint > 0 && max > d.OtMaxSetpoint {
+			max = d.OtMaxSetpoint
+		}
+	}
+	return min, max
+}
+
+// ValidateSetpoint check zone setpoint against ZoneLimits and TempStep. In
+// ValidateClamp mode setpoint is moved into limits and rounded instead of error.
+func (d *Device) ValidateSetpoint(zone string, value Celsius, mode ValidationMode) (Celsius, error) {
+	min, max := d.ZoneLimits(zone)
+	return d.validateSetpoint(zone, value, mode, min, max)
+}
+
+// ValidateCoolantSetpoint is ValidateSetpoint for zone regulated by coolant
+// temperature, setpoint is checked against CoolantLimits
+func (d *Device) ValidateCoolantSetpoint(zone string, value Celsius, mode ValidationMode) (Celsius, error) {
+	min, max := d.CoolantLimits(zone)
+	return d.validateSetpoint(zone, value, mode, min, max)
+}
+
+func (d *Device) validateSetpoint(zone string, value Celsius, mode ValidationMode, min, max Celsius) (Celsius, error) {
+	if mode == ValidateOff {
+		return value, nil
+	}
+	step := d.TempStep()
+
+	if mode == ValidateClamp {
+		value = value.Round(step)
+		if value < min {
+			value = min
+		}
+		if value > max {
+			value = max
+		}
+		return value, nil
+	}
+
+	if value < min || value > max || value.Round(step) != value {
+		return value, &SetpointError{DeviceID: d.ID, Zone: zone, Value: value, Min: min, Max: max, Step: step}
+	}
+	return value, nil
+}
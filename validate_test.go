@@ -0,0 +1,177 @@
+package zont
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testDevice(t *testing.T, data string) *Device {
+	t.Helper()
+	d := &Device{}
+	if err := json.Unmarshal([]byte(data), d); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestZoneLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		device   string
+		zone     string
+		min, max Celsius
+		cmin     Celsius
+		cmax     Celsius
+	}{
+		{"no limits", `{}`, "1", DefaultMinZoneTemp, DefaultMaxZoneTemp, 0, noLimit},
+		{"all zones", `{"thermostat_temps_limits":{"0":{"min":10,"max":30}}}`, "2", 10 * Degree, 30 * Degree, 10 * Degree, 30 * Degree},
+		{"zone 1", `{"thermostat_temps_limits":{"0":{"min":10,"max":30},"1":{"min":7.5,"max":null}}}`, "1", NewCelsius(7.5), 30 * Degree, NewCelsius(7.5), 30 * Degree},
+		{
+			"opentherm",
+			`{"ot_enabled":true,"ot_min_setpoint":30,"ot_max_setpoint":80}`,
+			"1", DefaultMinZoneTemp, DefaultMaxZoneTemp, 30 * Degree, 80 * Degree,
+		},
+		{
+			"opentherm max below zone max",
+			`{"ot_enabled":true,"ot_min_setpoint":30,"ot_max_setpoint":60,"thermostat_temps_limits":{"0":{"min":5,"max":85}}}`,
+			"1", 5 * Degree, 60 * Degree, 30 * Degree, 60 * Degree,
+		},
+		{
+			"opentherm disabled",
+			`{"ot_enabled":false,"ot_min_setpoint":30,"ot_max_setpoint":20}`,
+			"1", DefaultMinZoneTemp, DefaultMaxZoneTemp, 0, noLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDevice(t, tt.device)
+			if min, max := d.ZoneLimits(tt.zone); min != tt.min || max != tt.max {
+				t.Errorf("ZoneLimits = %s - %s, want %s - %s", min, max, tt.min, tt.max)
+			}
+			if min, max := d.CoolantLimits(tt.zone); min != tt.cmin || max != tt.cmax {
+				t.Errorf("CoolantLimits = %s - %s, want %s - %s", min, max, tt.cmin, tt.cmax)
+			}
+		})
+	}
+}
+
+func TestValidateSetpoint(t *testing.T) {
+	d := testDevice(t, `{"id":7,"ot_enabled":true,"ot_min_setpoint":30,"ot_max_setpoint":80}`)
+
+	tests := []struct {
+		value   float64
+		mode    ValidationMode
+		coolant bool
+		want    Celsius
+		fail    bool
+	}{
+		{21.5, ValidateStrict, false, 2150, false},
+		{210, ValidateStrict, false, 21000, true},
+		{21.55, ValidateStrict, false, 2155, true},
+		{210, ValidateClamp, false, 3500, false},
+		{21.55, ValidateClamp, false, 2160, false},
+		{2, ValidateClamp, false, 500, false},
+		{210, ValidateOff, false, 21000, false},
+		{60, ValidateStrict, true, 6000, false},
+		{20, ValidateStrict, true, 2000, true},
+		{90, ValidateClamp, true, 8000, false},
+	}
+	for _, tt := range tests {
+		validate := d.ValidateSetpoint
+		if tt.coolant {
+			validate = d.ValidateCoolantSetpoint
+		}
+		got, err := validate("1", NewCelsius(tt.value), tt.mode)
+		if (err != nil) != tt.fail {
+			t.Errorf("%v mode %d coolant %v: err = %v, want fail %v", tt.value, tt.mode, tt.coolant, err, tt.fail)
+			continue
+		}
+		var setpointErr *SetpointError
+		if err != nil && !errors.As(err, &setpointErr) {
+			t.Errorf("%v: error %T is not SetpointError", tt.value, err)
+		}
+		if got != tt.want {
+			t.Errorf("%v mode %d coolant %v = %s, want %s", tt.value, tt.mode, tt.coolant, got, tt.want)
+		}
+	}
+
+	open := testDevice(t, `{"id":7}`)
+	_, err := open.ValidateCoolantSetpoint("1", -5*Degree, ValidateStrict)
+	if err == nil || !strings.Contains(err.Error(), "below limit 0 °C") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSetTargetTempValidation(t *testing.T) {
+	devices, updates := 0, 0
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			devices++
+			w.Write([]byte(`{"ok":true,"devices":[{"id":7,"thermostat_temps_limits":{"0":{"min":5,"max":35}}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/update_device"):
+			updates++
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+
+	// validation is strict by default
+	var setpointErr *SetpointError
+	for _, temp := range []float64{210, 60} {
+		if err := cl.SetTargetTemp(7, "1", temp); !errors.As(err, &setpointErr) {
+			t.Errorf("%v: got %v, want SetpointError", temp, err)
+		}
+	}
+	if err := cl.SetTargetTemp(7, "1", 21); err != nil {
+		t.Fatal(err)
+	}
+	if devices != 1 || updates != 1 {
+		t.Errorf("default mode: %d devices and %d update requests", devices, updates)
+	}
+
+	cl.SetValidation(ValidateOff)
+	if err := cl.SetTargetTemp(7, "1", 60); err != nil {
+		t.Fatal(err)
+	}
+	if devices != 1 || updates != 2 {
+		t.Errorf("validation off: %d devices and %d update requests", devices, updates)
+	}
+}
+
+func TestSetpointTempStep(t *testing.T) {
+	updates := 0
+	cl := newTestClient(t, devicesHandler(t, `{"ok":true,"devices":[{"id":7,"tempstep":5},{"id":8}]}`, &updates))
+
+	var setpointErr *SetpointError
+	if err := cl.SetTargetTemp(7, "1", 21.3); !errors.As(err, &setpointErr) || setpointErr.Step != Degree/2 {
+		t.Errorf("got %v, want error with step 0.5", err)
+	}
+	if err := cl.SetTargetTemp(7, "1", 21.5); err != nil {
+		t.Error(err)
+	}
+	if err := cl.SetTargetTemp(8, "1", 21.3); err != nil {
+		t.Error(err)
+	}
+
+	cl.SetTempStep(8, Degree)
+	if err := cl.SetTargetTemp(8, "1", 21.5); !errors.As(err, &setpointErr) || setpointErr.Step != Degree {
+		t.Errorf("got %v, want error with configured step 1", err)
+	}
+	d, err := cl.Device(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.ValidateSetpoint("1", NewCelsius(21.4), ValidateClamp); got != 21*Degree {
+		t.Errorf("clamp to configured step = %s, want 21 °C", got)
+	}
+	cl.SetTempStep(8, 0)
+	if err := cl.SetTargetTemp(8, "1", 21.5); err != nil {
+		t.Error(err)
+	}
+	if updates != 3 {
+		t.Errorf("got %d updates, want 3", updates)
+	}
+}
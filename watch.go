@@ -0,0 +1,245 @@
+package zont
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventTempChanged       EventType = "temperature_changed"
+	EventOffline           EventType = "offline"
+	EventOnline            EventType = "online"
+	EventModeChanged       EventType = "mode_changed"
+	EventTargetTempChanged EventType = "target_temp_changed"
+	EventGuardTriggered    EventType = "guard_triggered"
+	EventBoilerFault       EventType = "boiler_fault"
+	EventBoilerFaultClear  EventType = "boiler_fault_clear"
+)
+
+// Event is change of device state found by Watch
+type Event struct {
+	Type     EventType
+	DeviceID int
+	Time     time.Time
+	// Sensor is thermometer uuid for EventTempChanged and zone for EventTargetTempChanged
+	Sensor string
+	Old    float64
+	New    float64
+	// Mode names for EventModeChanged
+	OldMode string
+	NewMode string
+	// GuardEvent is raw LastGuardEvent for EventGuardTriggered
+	GuardEvent interface{}
+}
+
+type watchState struct {
+	online     bool
+	extMode    int
+	mode       string
+	temps      map[string]float64
+	targets    map[string]float64
+	guardEvent interface{}
+	boilerFail bool
+}
+
+const defaultWatchInterval = time.Minute
+
+// Watch poll devices with deviceIds (all devices when empty) every interval (one
+// minute when not set) and send change events to returned channel. Channel is
+// closed when ctx is done.
+func (cl *Client) Watch(ctx context.Context, deviceIds []int, interval time.Duration) <-chan Event {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		previous := map[int]*watchState{}
+		for {
+			for _, e := range cl.watchPoll(ctx, deviceIds, previous) {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return events
+}
+
+func (cl *Client) watchPoll(ctx context.Context, deviceIds []int, previous map[int]*watchState) []Event {
+	if cl.AuthTokenResponse == nil || len(cl.AuthTokenResponse.Token) < 1 {
+		ContextLogger.Infoln("AuthToken not exist!")
+		return nil
+	}
+	resp := cl.GetDevices()
+	if resp == nil {
+		return nil
+	}
+
+	wanted := map[int]bool{}
+	for _, id := range deviceIds {
+		wanted[id] = true
+	}
+
+	var devices []*Device
+	var online []int
+	for i := range resp.Devices {
+		d := &resp.Devices[i]
+		if len(wanted) > 0 && !wanted[d.ID] {
+			continue
+		}
+		devices = append(devices, d)
+		if d.Online {
+			online = append(online, d.ID)
+		}
+	}
+
+	now := time.Now()
+	fails := cl.boilerFails(ctx, online, now)
+
+	var events []Event
+	for _, d := range devices {
+		current := snapshotState(d)
+		if fail, ok := fails[d.ID]; ok {
+			current.boilerFail = fail
+		} else if old, ok := previous[d.ID]; ok {
+			current.boilerFail = old.boilerFail
+		}
+
+		if old, ok := previous[d.ID]; ok {
+			events = append(events, diffState(d.ID, now, old, current)...)
+		}
+		previous[d.ID] = current
+	}
+	return events
+}
+
+// boilerFails return last boiler fail state of devices loaded with one batch,
+// devices which failed to load are missing in result
+func (cl *Client) boilerFails(ctx context.Context, deviceIds []int, now time.Time) map[int]bool {
+	fails := map[int]bool{}
+	if len(deviceIds) == 0 {
+		return fails
+	}
+	results := cl.LoadDataBatch(ctx, BatchRequest{
+		DeviceIDs: deviceIds,
+		DataTypes: []string{"thermostat_work"},
+		MinTime:   now.Add(-180 * time.Second).Unix(),
+		MaxTime:   now.Unix(),
+	})
+	for id, r := range results {
+		if r.Err != nil {
+			ContextLogger.Infoln("boiler fail state of device", id, "not loaded:", r.Err)
+			continue
+		}
+		last, ok := r.Data.History().Series["thermostat_work/fail"].Last()
+		fails[id] = ok && last.Value != 0
+	}
+	return fails
+}
+
+func snapshotState(d *Device) *watchState {
+	s := &watchState{
+		online:     d.Online,
+		extMode:    d.ThermostatExtMode,
+		mode:       d.ExtModeNames()[d.ThermostatExtMode],
+		temps:      map[string]float64{},
+		targets:    map[string]float64{},
+		guardEvent: d.LastGuardEvent,
+	}
+	if s.mode == "" {
+		s.mode = d.ThermostatMode
+	}
+	for _, t := range d.Thermometers {
+		s.temps[t.UUID] = t.LastValue.Float64()
+	}
+	if d.ThermostatTargetTemps != nil {
+		for zone, t := range *d.ThermostatTargetTemps {
+			s.targets[zone] = t.Temp.Float64()
+		}
+	}
+	return s
+}
+
+func diffState(deviceId int, now time.Time, old, current *watchState) []Event {
+	var events []Event
+	event := func(t EventType) Event {
+		return Event{Type: t, DeviceID: deviceId, Time: now}
+	}
+
+	if old.online != current.online {
+		if current.online {
+			events = append(events, event(EventOnline))
+		} else {
+			events = append(events, event(EventOffline))
+		}
+	}
+
+	if old.extMode != current.extMode || old.mode != current.mode {
+		e := event(EventModeChanged)
+		e.Old, e.New = float64(old.extMode), float64(current.extMode)
+		e.OldMode, e.NewMode = old.mode, current.mode
+		events = append(events, e)
+	}
+
+	for zone, temp := range current.targets {
+		if prev, ok := old.targets[zone]; ok && prev != temp {
+			e := event(EventTargetTempChanged)
+			e.Sensor, e.Old, e.New = zone, prev, temp
+			events = append(events, e)
+		}
+	}
+
+	for uuid, temp := range current.temps {
+		if prev, ok := old.temps[uuid]; ok && prev != temp {
+			e := event(EventTempChanged)
+			e.Sensor, e.Old, e.New = uuid, prev, temp
+			events = append(events, e)
+		}
+	}
+
+	if current.guardEvent != nil && !reflect.DeepEqual(old.guardEvent, current.guardEvent) {
+		e := event(EventGuardTriggered)
+		e.GuardEvent = current.guardEvent
+		events = append(events, e)
+	}
+
+	if old.boilerFail != current.boilerFail {
+		if current.boilerFail {
+			events = append(events, event(EventBoilerFault))
+		} else {
+			events = append(events, event(EventBoilerFaultClear))
+		}
+	}
+
+	return events
+}
+
+// String return human readable event description
+func (e Event) String() string {
+	switch e.Type {
+	case EventTempChanged, EventTargetTempChanged:
+		return fmt.Sprintf("device %d %s %s: %v -> %v", e.DeviceID, e.Type, e.Sensor, e.Old, e.New)
+	case EventModeChanged:
+		return fmt.Sprintf("device %d %s: %s -> %s", e.DeviceID, e.Type, e.OldMode, e.NewMode)
+	}
+	return fmt.Sprintf("device %d %s", e.DeviceID, e.Type)
+}
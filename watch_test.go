@@ -0,0 +1,122 @@
+package zont
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffState(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	state := func(change func(s *watchState)) *watchState {
+		s := &watchState{
+			online:  true,
+			extMode: 1,
+			mode:    "comfort",
+			temps:   map[string]float64{"t1": 21},
+			targets: map[string]float64{"1": 22},
+		}
+		if change != nil {
+			change(s)
+		}
+		return s
+	}
+	guard := map[string]interface{}{"time": 1700000000.0}
+
+	tests := []struct {
+		name    string
+		current *watchState
+		want    []Event
+	}{
+		{"unchanged", state(nil), nil},
+		{"offline", state(func(s *watchState) { s.online = false }),
+			[]Event{{Type: EventOffline}}},
+		{"mode", state(func(s *watchState) { s.extMode, s.mode = 2, "eco" }),
+			[]Event{{Type: EventModeChanged, Old: 1, New: 2, OldMode: "comfort", NewMode: "eco"}}},
+		{"target", state(func(s *watchState) { s.targets["1"] = 23 }),
+			[]Event{{Type: EventTargetTempChanged, Sensor: "1", Old: 22, New: 23}}},
+		{"new zone", state(func(s *watchState) { s.targets["2"] = 18 }), nil},
+		{"temperature", state(func(s *watchState) { s.temps["t1"] = 20.5 }),
+			[]Event{{Type: EventTempChanged, Sensor: "t1", Old: 21, New: 20.5}}},
+		{"guard", state(func(s *watchState) { s.guardEvent = guard }),
+			[]Event{{Type: EventGuardTriggered, GuardEvent: guard}}},
+		{"boiler fault", state(func(s *watchState) { s.boilerFail = true }),
+			[]Event{{Type: EventBoilerFault}}},
+		{"offline with fault", state(func(s *watchState) { s.online, s.boilerFail = false, true }),
+			[]Event{{Type: EventOffline}, {Type: EventBoilerFault}}},
+	}
+	for _, tt := range tests {
+		for i := range tt.want {
+			tt.want[i].DeviceID, tt.want[i].Time = 7, now
+		}
+		got := diffState(7, now, state(nil), tt.current)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// same guard event is reported once
+	old := state(func(s *watchState) { s.guardEvent = guard })
+	if got := diffState(7, now, old, old); len(got) != 0 {
+		t.Errorf("repeated guard event: got %+v", got)
+	}
+	// fault is cleared
+	got := diffState(7, now, state(func(s *watchState) { s.boilerFail = true }), state(nil))
+	if len(got) != 1 || got[0].Type != EventBoilerFaultClear {
+		t.Errorf("fault clear: got %+v", got)
+	}
+}
+
+func TestWatchPollBoilerFail(t *testing.T) {
+	var loads [][]int
+	fail := map[int]int{7: 0, 8: 1}
+	cl := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			w.Write([]byte(`{"ok":true,"devices":[{"id":7,"online":true},{"id":8,"online":true},{"id":9,"online":false}]}`))
+		case strings.HasSuffix(r.URL.Path, "/load_data"):
+			var request LoadDataRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			var responses []string
+			for _, dr := range request.Requests {
+				ids = append(ids, dr.DeviceID)
+				responses = append(responses, fmt.Sprintf(
+					`{"device_id":%d,"ok":true,"thermostat_work":{"fail":[[1700000000,%d]]}}`, dr.DeviceID, fail[dr.DeviceID]))
+			}
+			loads = append(loads, ids)
+			fmt.Fprintf(w, `{"ok":true,"responses":[%s]}`, strings.Join(responses, ","))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+
+	previous := map[int]*watchState{}
+	if events := cl.watchPoll(context.Background(), nil, previous); len(events) != 0 {
+		t.Errorf("first poll: got %+v", events)
+	}
+	if !reflect.DeepEqual(loads, [][]int{{7, 8}}) {
+		t.Errorf("got load_data calls %v, want one call for online devices 7 and 8", loads)
+	}
+
+	fail[7], fail[8] = 1, 0
+	events := cl.watchPoll(context.Background(), nil, previous)
+	got := map[int]EventType{}
+	for _, e := range events {
+		got[e.DeviceID] = e.Type
+	}
+	want := map[int]EventType{7: EventBoilerFault, 8: EventBoilerFaultClear}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+	if len(loads) != 2 {
+		t.Errorf("got %d load_data calls, want 2", len(loads))
+	}
+}